@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/radu2020/planet/internal/service"
+)
+
+// errorResponse is the JSON body sent back for rejected requests
+type errorResponse struct {
+	Error   string `json:"error"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// writeError sends a structured JSON error with the given status code
+func writeError(w http.ResponseWriter, status int, body errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Response failed: %v", err)
+	}
+}
+
+// writeBadRequest sends a 400 response, describing the invalid parameter when known
+func writeBadRequest(w http.ResponseWriter, err error) {
+	body := errorResponse{Error: "invalid_parameter", Message: err.Error()}
+
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		body.Param = validationErr.Param
+		body.Message = validationErr.Message
+	}
+	writeError(w, http.StatusBadRequest, body)
+}
+
+// writeServerError sends a 504 response when the request ran out of time and a
+// 500 response otherwise. Nothing is sent when the client went away.
+func writeServerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, errorResponse{Error: "timeout", Message: "the request took too long"})
+	case errors.Is(err, context.Canceled):
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -3,10 +3,11 @@ package main
 import (
 	"bytes"
 	"context"
-	"database/sql"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
 	"github.com/radu2020/planet/config"
 	"github.com/radu2020/planet/internal/service"
 	"github.com/radu2020/planet/internal/storage"
@@ -19,6 +20,7 @@ import (
 )
 
 type application struct {
+	config      config.Config
 	dataService *service.DataService
 	server      *http.Server
 }
@@ -27,25 +29,25 @@ func main() {
 	// Config
 	cfg := config.LoadConfig()
 
-	// Database
-	db, err := sql.Open("postgres", cfg.Database.ConnectionInfo())
+	// Storage
+	store, closeStore, err := openStorage(cfg)
 	if err != nil {
-		log.Fatalf("Failed to open postgres connection: %v", err)
+		log.Fatalf("Failed to open %s storage: %v", cfg.Storage, err)
 	}
-	defer db.Close()
-
-	// Storage
-	storage := storage.NewSqlStorage(db)
+	defer closeStore()
 
 	// Service
-	dataService := service.NewDataService(storage)
+	dataService := service.NewDataService(store)
 
 	// App
-	app := &application{dataService: dataService}
+	app := &application{config: cfg, dataService: dataService}
 
 	// Handlers
-	http.HandleFunc("GET /files/collection", app.getCollectionHandler)
-	http.HandleFunc("GET /organizations/ids", app.getOrgIDsHandler)
+	http.HandleFunc("GET /files/collection", withTimeout(cfg.CollectionTimeout, app.getCollectionHandler))
+	http.HandleFunc("GET /organizations/ids", withTimeout(cfg.OrgIDsTimeout, app.getOrgIDsHandler))
+	http.HandleFunc("GET /organizations/{id}/usage", withTimeout(cfg.UsageTimeout, app.getOrgUsageHandler))
+	http.HandleFunc("GET /tiles/{z}/{x}/{y}", withTimeout(cfg.TileTimeout, app.getTileHandler))
+	http.HandleFunc("GET /aggregations/grid", withTimeout(cfg.GridTimeout, app.getGridHandler))
 
 	// Create server
 	app.server = &http.Server{
@@ -82,14 +84,61 @@ func main() {
 }
 
 func (app *application) getCollectionHandler(w http.ResponseWriter, r *http.Request) {
-	// Get data
-	collection, err := app.dataService.GetCollection()
+	// Parse filters
+	filter, err := service.ParseCollectionFilter(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+
+	if service.IsPaged(r.URL.Query()) {
+		app.getCollectionPage(w, r, filter)
+		return
+	}
+
+	// Stream data
+	w.Header().Set("Content-Disposition", "attachment; filename=test.geojson")
+	w.Header().Set("Content-Type", "application/text")
+	err = app.dataService.StreamCollection(r.Context(), w, filter)
+	if errors.Is(err, service.ErrStreamInterrupted) {
+		log.Printf("Streaming collection interrupted: %v", err)
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to fetch collection: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		w.Header().Del("Content-Disposition")
+		writeServerError(w, err)
+		return
+	}
+}
+
+// getCollectionPage sends back a single page of the collection, linking to the
+// next page both in the Link header and in the "next" member of the collection
+func (app *application) getCollectionPage(w http.ResponseWriter, r *http.Request, filter storage.CollectionFilter) {
+	// Parse page
+	page, err := service.ParsePageRequest(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, err)
 		return
 	}
 
+	// Get data
+	collection, next, err := app.dataService.GetCollectionPage(r.Context(), filter, page)
+	if err != nil {
+		log.Printf("Failed to fetch collection page: %v", err)
+		writeServerError(w, err)
+		return
+	}
+
+	if next != "" {
+		query := r.URL.Query()
+		query.Set("cursor", next)
+		nextURL := r.URL.Path + "?" + query.Encode()
+
+		collection.ExtraMembers = map[string]interface{}{"next": nextURL}
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL))
+	}
+
 	// Marshal
 	payload, err := collection.MarshalJSON()
 	if err != nil {
@@ -99,26 +148,131 @@ func (app *application) getCollectionHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Send back data
-	w.Header().Set("Content-Disposition", "attachment; filename=test.geojson")
-	w.Header().Set("Content-Type", "application/text")
-	http.ServeContent(w, r, "test.geojson", time.Now(), bytes.NewReader(payload))
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(payload); err != nil {
+		log.Printf("Response failed: %v", err)
+	}
 }
 
 func (app *application) getOrgIDsHandler(w http.ResponseWriter, r *http.Request) {
 	// Get data
-	payload, err := app.dataService.GetOrgIDs()
+	payload, err := app.dataService.GetOrgIDs(r.Context())
 	if err != nil {
 		log.Printf("Fetching OrgIDs failed: %v", err)
+		writeServerError(w, err)
+		return
+	}
+
+	// Send back data
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Printf("Response failed: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
+
+func (app *application) getOrgUsageHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse organization and time window
+	orgID, err := service.ParseOrgID(r.PathValue("id"))
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+	filter, err := service.ParseCollectionFilter(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+
+	// Get data
+	payload, err := app.dataService.GetOrgUsage(r.Context(), orgID, filter.From, filter.To)
+	if errors.Is(err, service.ErrNoUsage) {
+		writeError(w, http.StatusNotFound, errorResponse{Error: "not_found", Message: err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Fetching usage of org %d failed: %v", orgID, err)
+		writeServerError(w, err)
+		return
+	}
 
 	// Send back data
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
 		log.Printf("Response failed: %v", err)
+	}
+}
+
+func (app *application) getTileHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse tile and filters
+	tile, err := service.ParseTile(r.PathValue("z"), r.PathValue("x"), r.PathValue("y"))
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+	filter, err := service.ParseCollectionFilter(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+
+	// Get data
+	payload, err := app.dataService.GetTile(r.Context(), tile, filter.OrgID)
+	if err != nil {
+		log.Printf("Failed to build tile %v: %v", tile, err)
+		writeServerError(w, err)
+		return
+	}
+
+	// Send back data
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", app.config.TileCacheMaxAge))
+	if len(payload) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	sum := sha1.Sum(payload)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(payload))
+}
+
+func (app *application) getGridHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse filters
+	filter, err := service.ParseCollectionFilter(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+	cellSize, err := service.ParseCellSize(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+
+	// Get data
+	grid, err := app.dataService.GetGrid(r.Context(), filter, cellSize)
+	if err != nil {
+		log.Printf("Failed to aggregate grid: %v", err)
+		writeServerError(w, err)
+		return
+	}
+
+	// Marshal
+	payload, err := grid.MarshalJSON()
+	if err != nil {
+		log.Printf("GeoJSON Collection marshal failed: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	// Send back data
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(payload); err != nil {
+		log.Printf("Response failed: %v", err)
+	}
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/lib/pq"
+	"github.com/radu2020/planet/config"
+	"github.com/radu2020/planet/internal/data"
+	"github.com/radu2020/planet/internal/storage"
+	"log"
+	"time"
+	_ "time/tzdata"
+)
+
+// openStorage opens the storage selected by the config and returns it with
+// the function closing it
+func openStorage(cfg config.Config) (storage.Storage, func() error, error) {
+	switch cfg.Storage {
+	case storage.BackendPostgres:
+		return openPostgres(cfg)
+	case storage.BackendSqlite:
+		s, err := storage.OpenSqlite(cfg.SqlitePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s.Close, nil
+	case storage.BackendMemory:
+		return openMemory(cfg)
+	}
+	return nil, nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+}
+
+// openMemory loads the input files of the config into a memory storage, so
+// that they are served without a database
+func openMemory(cfg config.Config) (storage.Storage, func() error, error) {
+	aliases, err := data.ParseColumnAliases(cfg.ColumnAliases)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := data.ColumnOptions{Aliases: aliases, KeepExtra: cfg.KeepExtraColumns}
+
+	location, err := time.LoadLocation(cfg.TimestampTimezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	timestamps := data.NewTimestampParser(data.TimestampOptions{
+		Layouts:   data.ParseTimestampLayouts(cfg.TimestampLayouts),
+		Location:  location,
+		MaxFuture: time.Duration(cfg.TimestampMaxFuture) * time.Second,
+	})
+
+	var repair *data.RepairOptions
+	if cfg.RepairGeometry {
+		repair = &data.RepairOptions{Precision: cfg.RepairPrecision}
+	}
+
+	files, err := data.ExpandInputs(cfg.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := storage.NewMemoryStorage()
+	opts := data.Options{
+		BatchSize: cfg.BatchSize,
+		Workers:   cfg.LoadWorkers,
+		Writers:   cfg.LoadWriters,
+		Writer:    s,
+		Repair:    repair,
+		Timestamp: timestamps,
+	}
+	for _, path := range files {
+		log.Printf("Loading %s", path)
+		if _, err := data.LoadFile(context.Background(), path, cfg.Format, columns, opts); err != nil {
+			return nil, nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+	}
+	return s, func() error { return nil }, nil
+}
+
+// openPostgres connects to the database, checks its schema and detects PostGIS
+func openPostgres(cfg config.Config) (storage.Storage, func() error, error) {
+	db, err := sql.Open("postgres", cfg.Database.ConnectionInfo())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Check schema
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("loading migrations: %w", err)
+	}
+	if err := migrator.CheckVersion(); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("refusing to start: %w", err)
+	}
+
+	s := storage.NewSqlStorage(db)
+	if err := s.DetectPostGIS(); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("detecting PostGIS: %w", err)
+	}
+	return s, db.Close, nil
+}
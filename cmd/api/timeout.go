@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// withTimeout cancels the context of the requests handled by h after the given
+// number of seconds, so their queries are stopped. Zero disables the timeout.
+func withTimeout(seconds int, h http.HandlerFunc) http.HandlerFunc {
+	if seconds <= 0 {
+		return h
+	}
+	timeout := time.Duration(seconds) * time.Second
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/radu2020/planet/internal/service"
+	"github.com/radu2020/planet/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingStorage holds every request until its context is done
+type blockingStorage struct {
+	storage.Storage
+}
+
+func (s blockingStorage) GetOrgIDs(ctx context.Context) ([]int, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newBlockingApp() *application {
+	return &application{dataService: service.NewDataService(blockingStorage{})}
+}
+
+// Test a request running out of time is answered with a timeout error
+func TestWithTimeout_GatewayTimeout(t *testing.T) {
+	app := newBlockingApp()
+	rec := httptest.NewRecorder()
+
+	withTimeout(1, app.getOrgIDsHandler)(rec, httptest.NewRequest(http.MethodGet, "/organizations/ids", nil))
+
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var body errorResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "timeout", body.Error)
+}
+
+// Test nothing is written back once the client went away
+func TestWithTimeout_Cancelled(t *testing.T) {
+	app := newBlockingApp()
+	rec := httptest.NewRecorder()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/organizations/ids", nil).WithContext(ctx)
+	withTimeout(10, app.getOrgIDsHandler)(rec, req)
+
+	assert.False(t, rec.Flushed)
+	assert.Empty(t, rec.Header())
+	assert.Zero(t, rec.Body.Len())
+}
@@ -1,43 +1,340 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	_ "github.com/lib/pq"
 	"github.com/radu2020/planet/config"
 	"github.com/radu2020/planet/internal/data"
 	"github.com/radu2020/planet/internal/storage"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 )
 
 func main() {
 	// Config
 	cfg := config.LoadConfig()
 
-	// Database connection
+	// Stop writing on SIGINT or SIGTERM, the checkpoints keep how far the load got
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Storage
+	store, err := openBackend(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to open %s storage: %v", cfg.Storage, err)
+	}
+	defer store.close()
+
+	// Geometry repair
+	var repair *data.RepairOptions
+	if cfg.RepairGeometry {
+		repair = &data.RepairOptions{Precision: cfg.RepairPrecision}
+	}
+
+	// Column mapping
+	aliases, err := data.ParseColumnAliases(cfg.ColumnAliases)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	columns := data.ColumnOptions{Aliases: aliases, KeepExtra: cfg.KeepExtraColumns}
+
+	// Timestamp parsing
+	location, err := time.LoadLocation(cfg.TimestampTimezone)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	timestamps := data.NewTimestampParser(data.TimestampOptions{
+		Layouts:   data.ParseTimestampLayouts(cfg.TimestampLayouts),
+		Location:  location,
+		MaxFuture: time.Duration(cfg.TimestampMaxFuture) * time.Second,
+	})
+
+	// Expand the input path into files
+	files, err := data.ExpandInputs(cfg.FilePath)
+	if err != nil {
+		log.Fatalf("Error finding input files: %v", err)
+	}
+
+	// Find where interrupted loads of the files stopped
+	resumes := make([]resume, len(files))
+	resuming := false
+	if checkpointing(cfg) {
+		for i, path := range files {
+			resumes[i] = findCheckpoint(ctx, store.checkpoints, path)
+			resuming = resuming || resumes[i].after > 0
+		}
+	}
+
+	// Open reject file. A resumed load appends to it, since the rows rejected
+	// before the checkpoint are not read again.
+	var rejects *data.RejectWriter
+	if cfg.RejectPath != "" {
+		if resuming {
+			rejects, err = data.OpenRejectFile(cfg.RejectPath)
+		} else {
+			rejects, err = data.CreateRejectFile(cfg.RejectPath)
+		}
+		if err != nil {
+			log.Fatalf("Failed to create reject file: %v", err)
+		}
+	}
+
+	// Load each file
+	opts := data.Options{
+		BatchSize: cfg.BatchSize,
+		Workers:   cfg.LoadWorkers,
+		Writers:   cfg.LoadWriters,
+		Writer:    store.writer,
+		Rejects:   rejects,
+		Repair:    repair,
+		Timestamp: timestamps,
+	}
+	start := time.Now()
+	var reports []data.LoadReport
+	var total data.LoadReport
+	var loadErrs []error
+	for i, path := range files {
+		log.Printf("Loading %s", path)
+		report, err := loadFile(ctx, store.checkpoints, cfg, path, resumes[i], columns, opts)
+		if err != nil {
+			report.Error = err.Error()
+			loadErrs = append(loadErrs, fmt.Errorf("%s: %w", path, err))
+		}
+		reports = append(reports, report)
+		total.Add(report)
+
+		if ctx.Err() != nil {
+			log.Println("Load interrupted")
+			break
+		}
+	}
+	total.Elapsed = time.Since(start)
+	loadErr := errors.Join(loadErrs...)
+
+	if err := rejects.Close(); err != nil {
+		log.Printf("Failed to close reject file: %v", err)
+	}
+
+	// Merge or discard the staged rows of all files
+	if store.staged != nil {
+		loadErr = finishStagedLoad(ctx, store.staged, &total, loadErr, cfg.MaxFailureRate)
+		if total.RolledBack {
+			for i := range reports {
+				reports[i].RolledBack = true
+				reports[i].RowsInserted = 0
+				reports[i].Duplicates = 0
+			}
+		}
+	}
+
+	// Print report
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(struct {
+		Files []data.LoadReport `json:"files"`
+		Total data.LoadReport   `json:"total"`
+	}{reports, total})
+	if err != nil {
+		log.Printf("Failed to print load report: %v", err)
+	}
+
+	if loadErr != nil {
+		log.Fatalf("Load failed: %v", loadErr)
+	}
+	if rate := total.FailureRate(); rate > cfg.MaxFailureRate {
+		log.Fatalf("Load failed: %.2f%% of the rows were rejected, the maximum is %.2f%%", rate*100, cfg.MaxFailureRate*100)
+	}
+	log.Println("Data successfully loaded into the database!")
+}
+
+// backend is the storage the loader writes to
+type backend struct {
+	writer      storage.Writer
+	checkpoints storage.CheckpointStore
+	staged      *storage.StagedLoad // set for atomic loads
+	close       func() error
+}
+
+// openBackend opens the storage selected by the config
+func openBackend(ctx context.Context, cfg config.Config) (backend, error) {
+	switch cfg.Storage {
+	case storage.BackendPostgres:
+		return openPostgres(ctx, cfg)
+	case storage.BackendSqlite:
+		if cfg.LoadAtomic {
+			return backend{}, errors.New("atomic loads need the postgres storage")
+		}
+		sqlite, err := storage.OpenSqlite(cfg.SqlitePath)
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{writer: sqlite, checkpoints: sqlite, close: sqlite.Close}, nil
+	case storage.BackendMemory:
+		return backend{}, errors.New("the memory storage is loaded by the API itself")
+	}
+	return backend{}, fmt.Errorf("unknown storage %q", cfg.Storage)
+}
+
+// openPostgres connects to the database and checks its schema. Atomic loads
+// write to a staging table in a single transaction, which is rolled back when
+// ctx is cancelled.
+func openPostgres(ctx context.Context, cfg config.Config) (b backend, err error) {
 	db, err := sql.Open("postgres", cfg.Database.ConnectionInfo())
 	if err != nil {
-		log.Fatalf("Failed to open postgres connection: %v", err)
+		return backend{}, err
 	}
-	defer db.Close()
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+
+	// Keep a connection per writer open between batches
+	db.SetMaxIdleConns(cfg.LoadWriters)
 
-	// Create table
-	err = storage.CreateTable(db)
+	// Check schema
+	migrator, err := storage.NewMigrator(db)
 	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+		return backend{}, fmt.Errorf("loading migrations: %w", err)
+	}
+	if err := migrator.CheckVersion(); err != nil {
+		return backend{}, fmt.Errorf("refusing to load data: %w", err)
 	}
 
-	// Open CSV file and process records
-	file := openCSVFile(cfg.FilePath)
-	defer file.Close()
-	data.ProcessCSVRecords(file, db, cfg.BatchSize)
+	// Fill the geometry column when PostGIS is available
+	spatial, err := storage.HasGeometryColumn(db)
+	if err != nil {
+		return backend{}, fmt.Errorf("detecting PostGIS: %w", err)
+	}
+	writer, err := storage.NewPostgresWriter(db, cfg.LoadMethod, spatial)
+	if err != nil {
+		return backend{}, err
+	}
+	b = backend{writer: writer, checkpoints: writer, close: db.Close}
+
+	if cfg.LoadAtomic {
+		b.staged, err = storage.BeginStagedLoad(ctx, db, cfg.LoadMethod, spatial)
+		if err != nil {
+			return backend{}, fmt.Errorf("starting staged load: %w", err)
+		}
+		b.writer = b.staged
+	}
+	return b, nil
+}
+
+// finishStagedLoad merges the staged rows into the data table when the load
+// succeeded and rolls them back otherwise. The report is updated to match.
+func finishStagedLoad(ctx context.Context, staged *storage.StagedLoad, report *data.LoadReport, loadErr error, maxFailureRate float64) error {
+	switch {
+	case loadErr != nil:
+	case report.BatchesFailed > 0:
+		loadErr = fmt.Errorf("%d batches failed", report.BatchesFailed)
+	case report.FailureRate() > maxFailureRate:
+		loadErr = fmt.Errorf("%.2f%% of the rows were rejected, the maximum is %.2f%%", report.FailureRate()*100, maxFailureRate*100)
+	default:
+		merged, err := staged.Commit(ctx)
+		if err == nil {
+			report.Duplicates = report.RowsInserted - merged
+			report.RowsInserted = merged
+			return nil
+		}
+		loadErr = fmt.Errorf("merging staged rows: %w", err)
+	}
+
+	if err := staged.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		log.Printf("Failed to roll back staged load: %v", err)
+	}
+	report.RolledBack = true
+	report.RowsInserted = 0
+	report.Duplicates = 0
+	return loadErr
+}
+
+// checkpointing reports whether loads record checkpoints. Atomic loads commit
+// nothing before the end, so they always start from the beginning.
+func checkpointing(cfg config.Config) bool {
+	return cfg.CheckpointEvery > 0 && !cfg.LoadAtomic
+}
+
+// resume is where the load of a file picks up
+type resume struct {
+	checksum string
+	after    int   // line of the checkpoint, 0 to load the whole file
+	err      error // reading the checkpoint failed
 }
 
-// openCSVFile opens the CSV file
-func openCSVFile(filePath string) *os.File {
-	file, err := os.Open(filePath)
+// findCheckpoint looks up the checkpoint of an interrupted load of the file
+func findCheckpoint(ctx context.Context, checkpoints storage.CheckpointStore, path string) resume {
+	checksum, err := fileChecksum(path)
 	if err != nil {
-		log.Fatal("Error opening CSV file:", err)
+		return resume{err: fmt.Errorf("checksumming file: %w", err)}
+	}
+	after, err := checkpoints.GetCheckpoint(ctx, checksum)
+	if err != nil {
+		return resume{err: fmt.Errorf("reading load checkpoint: %w", err)}
+	}
+	return resume{checksum: checksum, after: after}
+}
+
+// loadFile loads an input file and resumes from its checkpoint when
+// checkpoints are enabled
+func loadFile(ctx context.Context, checkpoints storage.CheckpointStore, cfg config.Config, path string, from resume, columns data.ColumnOptions, opts data.Options) (data.LoadReport, error) {
+	if from.err != nil {
+		return data.LoadReport{File: path, RowsRejected: map[string]int64{}}, from.err
+	}
+
+	// Resume an interrupted load from its checkpoint
+	if checkpointing(cfg) {
+		opts.ResumeAfter = from.after
+		if opts.ResumeAfter > 0 {
+			log.Printf("Resuming load of %s after line %d", path, opts.ResumeAfter)
+		}
+		opts.CheckpointEvery = cfg.CheckpointEvery
+		// Checkpoints are still saved after the load was interrupted, so the
+		// next run resumes where this one stopped
+		saveCtx := context.WithoutCancel(ctx)
+		opts.Checkpoint = func(line int) error {
+			return checkpoints.SaveCheckpoint(saveCtx, from.checksum, path, line)
+		}
+	}
+
+	report, err := data.LoadFile(ctx, path, cfg.Format, columns, opts)
+	if err != nil {
+		return report, err
+	}
+
+	// A complete load needs no checkpoint. After failed batches the checkpoint
+	// is kept, so the next run retries from the first row that was not written.
+	if checkpointing(cfg) && report.BatchesFailed == 0 {
+		if err := checkpoints.DeleteCheckpoint(ctx, from.checksum); err != nil {
+			log.Printf("Failed to delete load checkpoint: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// fileChecksum returns the hex encoded SHA-256 of the file at path
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
 	}
-	return file
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
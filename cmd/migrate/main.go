@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/lib/pq"
+	"github.com/radu2020/planet/config"
+	"github.com/radu2020/planet/internal/storage"
+	"log"
+	"os"
+	"strconv"
+)
+
+const usage = `Usage: migrate [command]
+
+Commands:
+  up         Apply all pending migrations (default)
+  down [n]   Revert the last n migrations (default 1)
+  version    Print the current schema version`
+
+func main() {
+	// Config
+	cfg := config.LoadConfig()
+
+	// Database connection
+	db, err := sql.Open("postgres", cfg.Database.ConnectionInfo())
+	if err != nil {
+		log.Fatalf("Failed to open postgres connection: %v", err)
+	}
+	defer db.Close()
+
+	// Migrations
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	command := "up"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatalf("Migration failed after applying %d migrations: %v", applied, err)
+		}
+		log.Printf("Applied %d migrations, schema is at version %d", applied, migrator.Latest())
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of migrations to revert: %s", os.Args[2])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			log.Fatalf("Migration failed after reverting %d migrations: %v", reverted, err)
+		}
+		log.Printf("Reverted %d migrations", reverted)
+	case "version":
+		version, err := migrator.Version()
+		if err != nil {
+			log.Fatalf("Failed to read schema version: %v", err)
+		}
+		fmt.Printf("%d (latest %d)\n", version, migrator.Latest())
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
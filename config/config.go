@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime"
 	"strconv"
 )
 
@@ -30,11 +31,34 @@ func DefaultPostgresConfig() PostgresConfig {
 }
 
 type Config struct {
-	Port      int            `json:"port"`
-	Env       string         `json:"env"`
-	Database  PostgresConfig `json:"database"`
-	FilePath  string         `json:"file_path"`
-	BatchSize int            `json:"batch_size"` // Number of records per batch to be inserted in the db
+	Port               int            `json:"port"`
+	Env                string         `json:"env"`
+	Database           PostgresConfig `json:"database"`
+	Storage            string         `json:"storage"`     // Storage backend: postgres, sqlite or memory
+	SqlitePath         string         `json:"sqlite_path"` // Database file of the sqlite storage
+	FilePath           string         `json:"file_path"`
+	Format             string         `json:"format"`               // Input format: csv, ndjson, geojson or parquet, empty to use the file extension
+	ColumnAliases      string         `json:"column_aliases"`       // Other column names of the fields, e.g. org_id=organization_id|org
+	KeepExtraColumns   bool           `json:"keep_extra_columns"`   // Keep unmapped columns as footprint properties
+	TimestampLayouts   string         `json:"timestamp_layouts"`    // Accepted timestamp layouts separated by ";", e.g. rfc3339;epoch_ms;2006-01-02 15:04:05
+	TimestampTimezone  string         `json:"timestamp_timezone"`   // Timezone of timestamps without a zone, e.g. Europe/Berlin
+	TimestampMaxFuture int            `json:"timestamp_max_future"` // Seconds a timestamp may lie in the future, 0 to allow any
+	BatchSize          int            `json:"batch_size"`           // Number of records per batch to be inserted in the db
+	LoadMethod         string         `json:"load_method"`          // How batches are written to the db, "insert" or "copy"
+	LoadAtomic         bool           `json:"load_atomic"`          // Load the whole file in one transaction or not at all
+	LoadWorkers        int            `json:"load_workers"`         // Number of goroutines validating records
+	LoadWriters        int            `json:"load_writers"`         // Number of goroutines inserting batches
+	CheckpointEvery    int            `json:"checkpoint_every"`     // Batches written between load checkpoints, 0 to disable
+	RejectPath         string         `json:"reject_path"`          // File receiving the rejected rows, .csv or JSON lines
+	RepairGeometry     bool           `json:"repair_geometry"`      // Repair footprints before validating them
+	RepairPrecision    int            `json:"repair_precision"`     // Decimal places repaired coordinates are rounded to, negative to keep them
+	MaxFailureRate     float64        `json:"max_failure_rate"`     // Share of rejected rows above which the loader exits non-zero
+	TileCacheMaxAge    int            `json:"tile_cache_max_age"`   // Seconds clients may cache vector tiles
+	CollectionTimeout  int            `json:"collection_timeout"`   // Seconds a collection request may take, 0 to disable
+	OrgIDsTimeout      int            `json:"org_ids_timeout"`      // Seconds an organization IDs request may take, 0 to disable
+	UsageTimeout       int            `json:"usage_timeout"`        // Seconds a usage request may take, 0 to disable
+	TileTimeout        int            `json:"tile_timeout"`         // Seconds a tile request may take, 0 to disable
+	GridTimeout        int            `json:"grid_timeout"`         // Seconds a grid request may take, 0 to disable
 }
 
 func (c Config) IsProd() bool {
@@ -44,11 +68,34 @@ func (c Config) IsProd() bool {
 // LoadConfig loads configuration from environment variables.
 func LoadConfig() Config {
 	c := Config{
-		Port:      getEnvInt("API_PORT", 8080),
-		Env:       getEnv("ENV", "dev"),
-		Database:  loadPostgresConfig(),
-		FilePath:  getEnv("FILE_PATH", "/app/data/sample.csv"),
-		BatchSize: getEnvInt("BATCH_SIZE", 50),
+		Port:               getEnvInt("API_PORT", 8080),
+		Env:                getEnv("ENV", "dev"),
+		Database:           loadPostgresConfig(),
+		Storage:            getEnv("STORAGE", "postgres"),
+		SqlitePath:         getEnv("SQLITE_PATH", "planet.db"),
+		FilePath:           getEnv("FILE_PATH", "/app/data/sample.csv"),
+		Format:             getEnv("FORMAT", ""),
+		ColumnAliases:      getEnv("COLUMN_ALIASES", ""),
+		KeepExtraColumns:   getEnvBool("KEEP_EXTRA_COLUMNS", false),
+		TimestampLayouts:   getEnv("TIMESTAMP_LAYOUTS", "rfc3339"),
+		TimestampTimezone:  getEnv("TIMESTAMP_TIMEZONE", "UTC"),
+		TimestampMaxFuture: getEnvInt("TIMESTAMP_MAX_FUTURE", 0),
+		BatchSize:          getEnvInt("BATCH_SIZE", 50),
+		LoadMethod:         getEnv("LOAD_METHOD", "insert"),
+		LoadAtomic:         getEnvBool("LOAD_ATOMIC", false),
+		LoadWorkers:        getEnvInt("LOAD_WORKERS", runtime.NumCPU()),
+		LoadWriters:        getEnvInt("LOAD_WRITERS", 4),
+		CheckpointEvery:    getEnvInt("CHECKPOINT_EVERY", 100),
+		RejectPath:         getEnv("REJECT_PATH", ""),
+		RepairGeometry:     getEnvBool("REPAIR_GEOMETRY", false),
+		RepairPrecision:    getEnvInt("REPAIR_PRECISION", -1),
+		MaxFailureRate:     getEnvFloat("MAX_FAILURE_RATE", 0.05),
+		TileCacheMaxAge:    getEnvInt("TILE_CACHE_MAX_AGE", 300),
+		CollectionTimeout:  getEnvInt("COLLECTION_TIMEOUT", 0),
+		OrgIDsTimeout:      getEnvInt("ORG_IDS_TIMEOUT", 10),
+		UsageTimeout:       getEnvInt("USAGE_TIMEOUT", 30),
+		TileTimeout:        getEnvInt("TILE_TIMEOUT", 10),
+		GridTimeout:        getEnvInt("GRID_TIMEOUT", 30),
 	}
 
 	log.Println("Successfully loaded configuration.")
@@ -87,3 +134,29 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return parsedValue
 }
+
+// getEnvBool reads a boolean environment variable or returns the default value if it's not set.
+func getEnvBool(key string, defaultValue bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsedValue, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return parsedValue
+}
+
+// getEnvFloat reads a float environment variable or returns the default value if it's not set.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsedValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return parsedValue
+}
@@ -43,8 +43,31 @@ func TestConfig_IsProd(t *testing.T) {
 func TestLoadConfig(t *testing.T) {
 	os.Setenv("API_PORT", "9090")
 	os.Setenv("ENV", "prod")
+	os.Setenv("STORAGE", "sqlite")
+	os.Setenv("SQLITE_PATH", "/tmp/planet.db")
 	os.Setenv("FILE_PATH", "/sample/data.csv")
+	os.Setenv("FORMAT", "ndjson")
+	os.Setenv("COLUMN_ALIASES", "org_id=organization_id")
+	os.Setenv("KEEP_EXTRA_COLUMNS", "true")
+	os.Setenv("TIMESTAMP_LAYOUTS", "rfc3339;epoch_ms")
+	os.Setenv("TIMESTAMP_TIMEZONE", "Europe/Berlin")
+	os.Setenv("TIMESTAMP_MAX_FUTURE", "3600")
 	os.Setenv("BATCH_SIZE", "100")
+	os.Setenv("TILE_CACHE_MAX_AGE", "60")
+	os.Setenv("COLLECTION_TIMEOUT", "120")
+	os.Setenv("ORG_IDS_TIMEOUT", "5")
+	os.Setenv("USAGE_TIMEOUT", "20")
+	os.Setenv("TILE_TIMEOUT", "0")
+	os.Setenv("GRID_TIMEOUT", "15")
+	os.Setenv("LOAD_METHOD", "copy")
+	os.Setenv("LOAD_ATOMIC", "true")
+	os.Setenv("LOAD_WORKERS", "3")
+	os.Setenv("LOAD_WRITERS", "2")
+	os.Setenv("CHECKPOINT_EVERY", "10")
+	os.Setenv("REJECT_PATH", "/tmp/rejects.jsonl")
+	os.Setenv("REPAIR_GEOMETRY", "true")
+	os.Setenv("REPAIR_PRECISION", "6")
+	os.Setenv("MAX_FAILURE_RATE", "0.2")
 	os.Setenv("POSTGRES_HOST", "db-host")
 	os.Setenv("POSTGRES_PORT", "6543")
 	os.Setenv("POSTGRES_USER", "admin")
@@ -55,8 +78,31 @@ func TestLoadConfig(t *testing.T) {
 
 	assert.Equal(t, 9090, cfg.Port)
 	assert.Equal(t, "prod", cfg.Env)
+	assert.Equal(t, "sqlite", cfg.Storage)
+	assert.Equal(t, "/tmp/planet.db", cfg.SqlitePath)
 	assert.Equal(t, "/sample/data.csv", cfg.FilePath)
+	assert.Equal(t, "ndjson", cfg.Format)
+	assert.Equal(t, "org_id=organization_id", cfg.ColumnAliases)
+	assert.True(t, cfg.KeepExtraColumns)
+	assert.Equal(t, "rfc3339;epoch_ms", cfg.TimestampLayouts)
+	assert.Equal(t, "Europe/Berlin", cfg.TimestampTimezone)
+	assert.Equal(t, 3600, cfg.TimestampMaxFuture)
 	assert.Equal(t, 100, cfg.BatchSize)
+	assert.Equal(t, 60, cfg.TileCacheMaxAge)
+	assert.Equal(t, 120, cfg.CollectionTimeout)
+	assert.Equal(t, 5, cfg.OrgIDsTimeout)
+	assert.Equal(t, 20, cfg.UsageTimeout)
+	assert.Equal(t, 0, cfg.TileTimeout)
+	assert.Equal(t, 15, cfg.GridTimeout)
+	assert.Equal(t, "copy", cfg.LoadMethod)
+	assert.True(t, cfg.LoadAtomic)
+	assert.Equal(t, 3, cfg.LoadWorkers)
+	assert.Equal(t, 2, cfg.LoadWriters)
+	assert.Equal(t, 10, cfg.CheckpointEvery)
+	assert.Equal(t, "/tmp/rejects.jsonl", cfg.RejectPath)
+	assert.True(t, cfg.RepairGeometry)
+	assert.Equal(t, 6, cfg.RepairPrecision)
+	assert.Equal(t, 0.2, cfg.MaxFailureRate)
 	assert.Equal(t, "db-host", cfg.Database.Host)
 	assert.Equal(t, 6543, cfg.Database.Port)
 	assert.Equal(t, "admin", cfg.Database.User)
@@ -79,3 +125,21 @@ func TestGetEnvInt(t *testing.T) {
 	os.Setenv("INVALID_INT", "not_a_number")
 	assert.Equal(t, 10, getEnvInt("INVALID_INT", 10)) // Should return default
 }
+
+// Test getEnvBool helper function
+func TestGetEnvBool(t *testing.T) {
+	os.Setenv("EXISTING_BOOL", "true")
+	assert.True(t, getEnvBool("EXISTING_BOOL", false))
+	assert.False(t, getEnvBool("MISSING_BOOL", false)) // Default value
+	os.Setenv("INVALID_BOOL", "maybe")
+	assert.True(t, getEnvBool("INVALID_BOOL", true)) // Should return default
+}
+
+// Test getEnvFloat helper function
+func TestGetEnvFloat(t *testing.T) {
+	os.Setenv("EXISTING_FLOAT", "0.25")
+	assert.Equal(t, 0.25, getEnvFloat("EXISTING_FLOAT", 0.1))
+	assert.Equal(t, 0.1, getEnvFloat("MISSING_FLOAT", 0.1)) // Default value
+	os.Setenv("INVALID_FLOAT", "not_a_number")
+	assert.Equal(t, 0.1, getEnvFloat("INVALID_FLOAT", 0.1)) // Should return default
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ColumnOptions configures how the columns of an input file map to the fields
+// of a record
+type ColumnOptions struct {
+	Aliases   map[string][]string // Other names of each field, e.g. "org_id": {"organization_id"}
+	KeepExtra bool                // Keep the other columns as properties of the footprint
+}
+
+// ParseColumnAliases parses aliases written as
+// "org_id=organization_id|org,source_event_timestamp=event_time"
+func ParseColumnAliases(s string) (map[string][]string, error) {
+	aliases := make(map[string][]string)
+	if strings.TrimSpace(s) == "" {
+		return aliases, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		field, names, ok := strings.Cut(entry, "=")
+		field = normalizeColumn(field)
+		if !ok || names == "" {
+			return nil, fmt.Errorf("invalid column alias %q, expected field=name|name", entry)
+		}
+		if !slices.Contains(recordColumns, field) {
+			return nil, fmt.Errorf("unknown column %q, expected one of %s", field, strings.Join(recordColumns, ", "))
+		}
+		for _, name := range strings.Split(names, "|") {
+			aliases[field] = append(aliases[field], normalizeColumn(name))
+		}
+	}
+	return aliases, nil
+}
+
+// normalizeColumn trims a column name, drops a byte order mark and folds its
+// case, so names match however the export wrote them
+func normalizeColumn(name string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+}
+
+// fieldIndex returns the position in a record of each accepted column name
+func (o ColumnOptions) fieldIndex() map[string]int {
+	index := make(map[string]int)
+	for i, field := range recordColumns {
+		index[field] = i
+		for _, alias := range o.Aliases[field] {
+			index[normalizeColumn(alias)] = i
+		}
+	}
+	return index
+}
+
+// accepted returns the names accepted for a field
+func (o ColumnOptions) accepted(field string) string {
+	return strings.Join(append([]string{field}, o.Aliases[field]...), ", ")
+}
+
+// columnMapping is where the fields of a record are in a header
+type columnMapping struct {
+	fields []int          // header position of each field
+	extra  map[int]string // header position and name of the other columns, when kept
+}
+
+// mapColumns maps a header to the record fields. Every field is required.
+func mapColumns(header []string, opts ColumnOptions) (columnMapping, error) {
+	index := opts.fieldIndex()
+	mapping := columnMapping{fields: []int{-1, -1, -1}}
+	if opts.KeepExtra {
+		mapping.extra = make(map[int]string)
+	}
+
+	for position, name := range header {
+		field, ok := index[normalizeColumn(name)]
+		switch {
+		case ok && mapping.fields[field] >= 0:
+			return mapping, fmt.Errorf("column %s appears twice in the header", recordColumns[field])
+		case ok:
+			mapping.fields[field] = position
+		case opts.KeepExtra:
+			mapping.extra[position] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		}
+	}
+
+	for field, position := range mapping.fields {
+		if position < 0 {
+			return mapping, fmt.Errorf("missing required column %s (accepted names: %s)", recordColumns[field], opts.accepted(recordColumns[field]))
+		}
+	}
+	return mapping, nil
+}
+
+// record picks the fields of a record from a row with one value per column
+func (m columnMapping) record(row []string) []string {
+	record := make([]string, len(m.fields))
+	for i, position := range m.fields {
+		record[i] = row[position]
+	}
+	if len(m.extra) > 0 {
+		properties := make(map[string]json.RawMessage, len(m.extra))
+		for position, name := range m.extra {
+			properties[name], _ = json.Marshal(row[position])
+		}
+		record[1] = withProperties(record[1], properties)
+	}
+	return record
+}
+
+// withProperties adds properties to a footprint. Footprints that are not JSON
+// objects are returned as is and left to the validators.
+func withProperties(footprint string, properties map[string]json.RawMessage) string {
+	var feature map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(footprint), &feature); err != nil || feature == nil {
+		return footprint
+	}
+
+	merged := make(map[string]json.RawMessage)
+	if p, ok := feature["properties"]; ok && jsonField(p) != "" {
+		if err := json.Unmarshal(p, &merged); err != nil {
+			return footprint
+		}
+	}
+	for name, value := range properties {
+		merged[name] = value
+	}
+
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return footprint
+	}
+	feature["properties"] = encoded
+	result, err := json.Marshal(feature)
+	if err != nil {
+		return footprint
+	}
+	return string(result)
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseColumnAliases(t *testing.T) {
+	aliases, err := ParseColumnAliases("org_id=organization_id|Org, source_event_timestamp=event_time")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"org_id":                 {"organization_id", "org"},
+		"source_event_timestamp": {"event_time"},
+	}, aliases)
+
+	aliases, err = ParseColumnAliases("")
+	assert.NoError(t, err)
+	assert.Empty(t, aliases)
+
+	_, err = ParseColumnAliases("customer=client_id")
+	assert.Error(t, err)
+	_, err = ParseColumnAliases("org_id")
+	assert.Error(t, err)
+}
+
+func TestMapColumns(t *testing.T) {
+	opts := ColumnOptions{Aliases: map[string][]string{"org_id": {"organization_id"}}}
+
+	mapping, err := mapColumns([]string{"\ufeffSource_Event_Timestamp", "region", "Organization_ID", "footprints_used"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3, 0}, mapping.fields)
+	assert.Empty(t, mapping.extra)
+
+	_, err = mapColumns([]string{"org", "footprints_used", "source_event_timestamp"}, opts)
+	assert.EqualError(t, err, "missing required column org_id (accepted names: org_id, organization_id)")
+
+	_, err = mapColumns([]string{"org_id", "organization_id", "footprints_used", "source_event_timestamp"}, opts)
+	assert.Error(t, err)
+}
+
+func TestColumnMapping_KeepExtra(t *testing.T) {
+	mapping, err := mapColumns([]string{"region", "org_id", "footprints_used", "source_event_timestamp"}, ColumnOptions{KeepExtra: true})
+	assert.NoError(t, err)
+
+	record := mapping.record([]string{"eu-west", "1", `{"type":"Feature","geometry":null,"properties":{"name":"field"}}`, "2025-02-09T15:04:05Z"})
+	assert.Equal(t, "1", record[0])
+	assert.JSONEq(t, `{"type":"Feature","geometry":null,"properties":{"name":"field","region":"eu-west"}}`, record[1])
+	assert.Equal(t, "2025-02-09T15:04:05Z", record[2])
+
+	// Footprints that are not objects are left to the validators
+	record = mapping.record([]string{"eu-west", "1", `not json`, "2025-02-09T15:04:05Z"})
+	assert.Equal(t, "not json", record[1])
+}
+
+func TestCSVSource_ColumnMapping(t *testing.T) {
+	input := "event_time,org,footprints_used,region\n" +
+		"2025-02-09T15:04:05Z,1," + csvFootprint + ",eu-west\n" +
+		"2025-02-09T15:04:05Z,2\n"
+	columns := ColumnOptions{
+		Aliases:   map[string][]string{"org_id": {"org"}, "source_event_timestamp": {"event_time"}},
+		KeepExtra: true,
+	}
+
+	source, err := NewSource(FormatCSV, strings.NewReader(input), columns)
+	assert.NoError(t, err)
+
+	records, _, errs := readAll(t, source)
+	assert.NoError(t, errs[0])
+	assert.Equal(t, "1", records[0][0])
+	assert.Contains(t, records[0][1], `"region":"eu-west"`)
+	assert.Equal(t, "2025-02-09T15:04:05Z", records[0][2])
+
+	assert.Equal(t, ReasonWrongColumnCount, errs[1].(*RecordError).Reason)
+	assert.Equal(t, []string{"2025-02-09T15:04:05Z", "2"}, records[1])
+}
+
+func TestCSVSource_MissingColumn(t *testing.T) {
+	_, err := NewSource(FormatCSV, strings.NewReader("org_id,footprint,source_event_timestamp\n"), ColumnOptions{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing required column footprints_used")
+}
+
+func TestNDJSONSource_ColumnMapping(t *testing.T) {
+	input := `{"Org":1,"footprints_used":` + testFootprint + `,"event_time":"2025-02-09T15:04:05Z","device":{"id":7}}`
+	columns := ColumnOptions{
+		Aliases:   map[string][]string{"org_id": {"org"}, "source_event_timestamp": {"event_time"}},
+		KeepExtra: true,
+	}
+
+	source, err := NewSource(FormatNDJSON, strings.NewReader(input), columns)
+	assert.NoError(t, err)
+
+	records, _, errs := readAll(t, source)
+	assert.NoError(t, errs[0])
+	assert.Equal(t, "1", records[0][0])
+	assert.Contains(t, records[0][1], `"device":{"id":7}`)
+	assert.Equal(t, "2025-02-09T15:04:05Z", records[0][2])
+}
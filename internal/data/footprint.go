@@ -0,0 +1,113 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Rules a footprint is validated against
+const (
+	RuleInvalidJSON      = "invalid_json"
+	RuleNotFeature       = "not_a_feature"
+	RuleInvalidGeometry  = "invalid_geometry"
+	RuleMissingGeometry  = "missing_geometry"
+	RuleGeometryType     = "unsupported_geometry_type"
+	RuleTooFewVertices   = "too_few_vertices"
+	RuleUnclosedRing     = "unclosed_ring"
+	RuleCoordinateBounds = "coordinate_out_of_bounds"
+)
+
+// minRingVertices is the minimum number of positions of a linear ring,
+// including the closing position (RFC 7946 section 3.1.6)
+const minRingVertices = 4
+
+// FootprintError is returned when a footprint breaks a validation rule
+type FootprintError struct {
+	Rule    string
+	Message string
+}
+
+func (e *FootprintError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Rule, e.Message)
+}
+
+// ValidateFootprint decodes a GeoJSON Feature and checks that its geometry is
+// a Polygon or MultiPolygon with closed rings of at least four positions and
+// WGS84 coordinates. The feature is repaired before it is checked when repair
+// is set. It returns the decoded feature or a *FootprintError.
+func ValidateFootprint(footprint string, repair *RepairOptions) (*geojson.Feature, error) {
+	f, err := decodeFootprint(footprint)
+	if err != nil {
+		return nil, err
+	}
+	if repair != nil {
+		RepairFeature(f, *repair)
+	}
+	if err := validateFeature(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// decodeFootprint decodes a GeoJSON Feature without checking its geometry
+func decodeFootprint(footprint string) (*geojson.Feature, error) {
+	var doc struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(footprint), &doc); err != nil {
+		return nil, &FootprintError{Rule: RuleInvalidJSON, Message: err.Error()}
+	}
+	if doc.Type != "Feature" {
+		return nil, &FootprintError{Rule: RuleNotFeature, Message: fmt.Sprintf("type is %q, expected \"Feature\"", doc.Type)}
+	}
+
+	f, err := geojson.UnmarshalFeature([]byte(footprint))
+	if err != nil {
+		return nil, &FootprintError{Rule: RuleInvalidGeometry, Message: err.Error()}
+	}
+	return f, nil
+}
+
+// validateFeature checks the geometry of a decoded feature
+func validateFeature(f *geojson.Feature) error {
+	switch g := f.Geometry.(type) {
+	case nil:
+		return &FootprintError{Rule: RuleMissingGeometry, Message: "feature has no geometry"}
+	case orb.Polygon:
+		return validatePolygon(g)
+	case orb.MultiPolygon:
+		for _, polygon := range g {
+			if err := validatePolygon(polygon); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return &FootprintError{Rule: RuleGeometryType, Message: fmt.Sprintf("geometry is a %s, expected Polygon or MultiPolygon", g.GeoJSONType())}
+	}
+}
+
+// validatePolygon checks the rings of a polygon
+func validatePolygon(polygon orb.Polygon) error {
+	if len(polygon) == 0 {
+		return &FootprintError{Rule: RuleTooFewVertices, Message: "polygon has no rings"}
+	}
+
+	for i, ring := range polygon {
+		if len(ring) < minRingVertices {
+			return &FootprintError{Rule: RuleTooFewVertices, Message: fmt.Sprintf("ring %d has %d positions, expected at least %d", i, len(ring), minRingVertices)}
+		}
+		if !ring.Closed() {
+			return &FootprintError{Rule: RuleUnclosedRing, Message: fmt.Sprintf("ring %d does not end at its first position", i)}
+		}
+		for _, point := range ring {
+			if point.Lon() < -180 || point.Lon() > 180 || point.Lat() < -90 || point.Lat() > 90 {
+				return &FootprintError{Rule: RuleCoordinateBounds, Message: fmt.Sprintf("position %v of ring %d is outside WGS84 bounds", point, i)}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFootprint(t *testing.T) {
+	f, err := ValidateFootprint(testFootprint, nil)
+
+	assert.NoError(t, err)
+	assert.IsType(t, orb.Polygon{}, f.Geometry)
+}
+
+func TestValidateFootprint_MultiPolygon(t *testing.T) {
+	footprint := `{"type":"Feature","geometry":{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[2,2],[3,2],[3,3],[2,2]]]]},"properties":{}}`
+
+	_, err := ValidateFootprint(footprint, nil)
+	assert.NoError(t, err)
+}
+
+func TestValidateFootprint_Repair(t *testing.T) {
+	footprint := `{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1]]]}}`
+
+	f, err := ValidateFootprint(footprint, &RepairOptions{Precision: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{RepairClosedRing}, f.Properties[RepairsProperty])
+
+	_, err = ValidateFootprint(footprint, nil)
+	var footprintErr *FootprintError
+	assert.True(t, errors.As(err, &footprintErr))
+	assert.Equal(t, RuleUnclosedRing, footprintErr.Rule)
+}
+
+func TestValidateFootprint_Invalid(t *testing.T) {
+	tests := []struct {
+		footprint string
+		rule      string
+	}{
+		{`{"type":"Feature",`, RuleInvalidJSON},
+		{`{"type":"FeatureCollection","features":[]}`, RuleNotFeature},
+		{`null`, RuleNotFeature},
+		{`{"type":"Feature","geometry":{"type":"Polygon"}}`, RuleInvalidGeometry},
+		{`{"type":"Feature","geometry":null}`, RuleMissingGeometry},
+		{`{"type":"Feature"}`, RuleMissingGeometry},
+		{`{"type":"Feature","geometry":{"type":"Point","coordinates":[13.34,52.45]}}`, RuleGeometryType},
+		{`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[]}}`, RuleTooFewVertices},
+		{`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[0,0]]]}}`, RuleTooFewVertices},
+		{`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1]]]}}`, RuleUnclosedRing},
+		{`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[181,0],[1,1],[0,0]]]}}`, RuleCoordinateBounds},
+		{`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[52.45,13.34],[52.46,13.34],[52.46,91],[52.45,13.34]]]}}`, RuleCoordinateBounds},
+		{`{"type":"Feature","geometry":{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[2,2],[3,2],[3,3]]]]}}`, RuleTooFewVertices},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			f, err := ValidateFootprint(tt.footprint, nil)
+
+			var footprintErr *FootprintError
+			assert.True(t, errors.As(err, &footprintErr), "expected a FootprintError, got %v", err)
+			assert.Equal(t, tt.rule, footprintErr.Rule)
+			assert.Nil(t, f)
+		})
+	}
+}
+
+func TestParseRecord_FootprintRule(t *testing.T) {
+	_, err := parseRecord([]string{"1", `{"type":"Feature","geometry":null}`, "2025-02-09T15:04:05Z"}, defaultTimestamps, nil)
+
+	var footprintErr *FootprintError
+	assert.True(t, errors.As(err, &footprintErr))
+	assert.Equal(t, RuleMissingGeometry, footprintErr.Rule)
+}
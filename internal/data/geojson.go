@@ -0,0 +1,127 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// geojsonSource reads a GeoJSON FeatureCollection whose features carry the
+// org_id and source_event_timestamp as properties. The features are decoded
+// one at a time, so the collection is never held in memory.
+type geojsonSource struct {
+	decoder    *json.Decoder
+	fields     map[string]int
+	inFeatures bool
+	index      int
+}
+
+func newGeoJSONSource(r io.Reader, columns ColumnOptions) (*geojsonSource, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('{') {
+		return nil, errors.New("GeoJSON input is not an object")
+	}
+	return &geojsonSource{decoder: decoder, fields: columns.fieldIndex()}, nil
+}
+
+func (s *geojsonSource) Next() ([]string, int, error) {
+	// Find the features array, skipping the other members
+	for !s.inFeatures {
+		token, err := s.token()
+		if err != nil {
+			return nil, 0, err
+		}
+		if token == json.Delim('}') {
+			return nil, 0, io.EOF
+		}
+		if token != "features" {
+			var skipped json.RawMessage
+			if err := s.decoder.Decode(&skipped); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+
+		token, err = s.token()
+		if err != nil {
+			return nil, 0, err
+		}
+		if token != json.Delim('[') {
+			return nil, 0, errors.New("GeoJSON features is not an array")
+		}
+		s.inFeatures = true
+	}
+
+	if !s.decoder.More() {
+		// Consume the end of the array and read the remaining members
+		if _, err := s.token(); err != nil {
+			return nil, 0, err
+		}
+		s.inFeatures = false
+		return s.Next()
+	}
+
+	var raw json.RawMessage
+	if err := s.decoder.Decode(&raw); err != nil {
+		return nil, 0, err
+	}
+	s.index++
+
+	record, err := featureRecord(raw, s.fields)
+	if err != nil {
+		return []string{string(raw)}, s.index, &RecordError{Reason: ReasonMalformedJSON, Message: err.Error(), Err: err}
+	}
+	return record, s.index, nil
+}
+
+// token reads the next token, the input cannot end inside the collection
+func (s *geojsonSource) token() (json.Token, error) {
+	token, err := s.decoder.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return token, err
+}
+
+// featureRecord moves the org_id and source_event_timestamp properties of a
+// feature into a record, the rest of the feature is the footprint
+func featureRecord(raw json.RawMessage, fields map[string]int) ([]string, error) {
+	var feature map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &feature); err != nil {
+		return nil, err
+	}
+	var properties map[string]json.RawMessage
+	if p, ok := feature["properties"]; ok && jsonField(p) != "" {
+		if err := json.Unmarshal(p, &properties); err != nil {
+			return nil, err
+		}
+	}
+
+	record := make([]string, len(recordColumns))
+	for name, value := range properties {
+		if field, ok := fields[normalizeColumn(name)]; ok && field != 1 {
+			record[field] = jsonField(value)
+			delete(properties, name)
+		}
+	}
+
+	if len(properties) > 0 {
+		encoded, err := json.Marshal(properties)
+		if err != nil {
+			return nil, err
+		}
+		feature["properties"] = encoded
+	} else {
+		feature["properties"] = json.RawMessage("null")
+	}
+	footprint, err := json.Marshal(feature)
+	if err != nil {
+		return nil, err
+	}
+	record[1] = string(footprint)
+	return record, nil
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoJSONSource(t *testing.T) {
+	input := `{
+		"type": "FeatureCollection",
+		"bbox": [0, 0, 1, 1],
+		"features": [
+			{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]},"properties":{"org_id":1,"source_event_timestamp":"2025-02-09T15:04:05Z","name":"field"}},
+			{"type":"Feature","geometry":null,"properties":{"org_id":"2","source_event_timestamp":"2025-02-09T15:04:05Z"}},
+			[1, 2]
+		],
+		"name": "usage"
+	}`
+
+	source, err := NewSource(FormatGeoJSON, strings.NewReader(input), ColumnOptions{})
+	assert.NoError(t, err)
+
+	records, lines, errs := readAll(t, source)
+	assert.Equal(t, []int{1, 2, 3}, lines)
+
+	assert.NoError(t, errs[0])
+	assert.Equal(t, "1", records[0][0])
+	assert.Equal(t, "2025-02-09T15:04:05Z", records[0][2])
+	assert.JSONEq(t, `{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]},"properties":{"name":"field"}}`, records[0][1])
+
+	assert.NoError(t, errs[1])
+	assert.Equal(t, "2", records[1][0])
+	assert.JSONEq(t, `{"type":"Feature","geometry":null,"properties":null}`, records[1][1])
+
+	assert.Equal(t, ReasonMalformedJSON, errs[2].(*RecordError).Reason)
+}
+
+func TestGeoJSONSource_Truncated(t *testing.T) {
+	source, err := NewSource(FormatGeoJSON, strings.NewReader(`{"type":"FeatureCollection","features":[{"type":"Feature"}`), ColumnOptions{})
+	assert.NoError(t, err)
+
+	_, _, err = source.Next()
+	assert.NoError(t, err)
+	_, _, err = source.Next()
+	assert.Error(t, err)
+}
+
+func TestGeoJSONSource_NotAnObject(t *testing.T) {
+	_, err := NewSource(FormatGeoJSON, strings.NewReader(`[]`), ColumnOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions of the input files
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Magic bytes the compressed files start with
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressionExtensions are ignored when detecting the format of a file
+var compressionExtensions = []string{".gz", ".gzip", ".zst", ".zstd"}
+
+// ExpandInputs returns the files a path refers to: the file itself, the files
+// of a directory, or the files matching a glob pattern, in lexical order.
+// Hidden files and subdirectories are skipped.
+func ExpandInputs(path string) ([]string, error) {
+	info, statErr := os.Stat(path)
+	if statErr == nil && !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var candidates []string
+	if statErr == nil {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			candidates = append(candidates, filepath.Join(path, entry.Name()))
+		}
+	} else {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, statErr
+		}
+		candidates = matches
+	}
+
+	var files []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(filepath.Base(candidate), ".") {
+			continue
+		}
+		if info, err := os.Stat(candidate); err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, candidate)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no input files in %s", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Input is the content of an input file, decompressed when needed
+type Input struct {
+	Reader      io.Reader
+	Compression string // gzip, zstd or empty for plain files
+	close       func()
+}
+
+// Close releases the decoder, the file itself is closed by the caller
+func (in Input) Close() {
+	if in.close != nil {
+		in.close()
+	}
+}
+
+// Decompress detects gzip and zstd files from their magic bytes. Plain files
+// are read as is, so seekable formats such as Parquet can still seek.
+func Decompress(file io.ReadSeeker) (Input, error) {
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Input{}, err
+	}
+	magic = magic[:n]
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Input{}, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			return Input{}, err
+		}
+		return Input{Reader: reader, Compression: CompressionGzip}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			return Input{}, err
+		}
+		return Input{Reader: decoder, Compression: CompressionZstd, close: decoder.Close}, nil
+	default:
+		return Input{Reader: file}, nil
+	}
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"usage-2024-07-01-1.csv.gz", "usage-2024-07-01-0.csv.gz", "usage-2024-07-02-0.csv.gz", ".hidden.csv"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "archive"), 0o755))
+
+	// A file
+	files, err := ExpandInputs(filepath.Join(dir, "usage-2024-07-02-0.csv.gz"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "usage-2024-07-02-0.csv.gz")}, files)
+
+	// A directory
+	files, err = ExpandInputs(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "usage-2024-07-01-0.csv.gz"),
+		filepath.Join(dir, "usage-2024-07-01-1.csv.gz"),
+		filepath.Join(dir, "usage-2024-07-02-0.csv.gz"),
+	}, files)
+
+	// A glob
+	files, err = ExpandInputs(filepath.Join(dir, "usage-2024-07-01-*.csv.gz"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "usage-2024-07-01-0.csv.gz"),
+		filepath.Join(dir, "usage-2024-07-01-1.csv.gz"),
+	}, files)
+
+	_, err = ExpandInputs(filepath.Join(dir, "missing.csv"))
+	assert.Error(t, err)
+	_, err = ExpandInputs(filepath.Join(dir, "archive"))
+	assert.Error(t, err)
+}
+
+func TestDecompress(t *testing.T) {
+	content := []byte(csvInput(2))
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write(content)
+	assert.NoError(t, gz.Close())
+
+	var zstded bytes.Buffer
+	zw, err := zstd.NewWriter(&zstded)
+	assert.NoError(t, err)
+	_, _ = zw.Write(content)
+	assert.NoError(t, zw.Close())
+
+	tests := map[string]struct {
+		input       []byte
+		compression string
+	}{
+		"plain": {content, ""},
+		"gzip":  {gzipped.Bytes(), CompressionGzip},
+		"zstd":  {zstded.Bytes(), CompressionZstd},
+		"empty": {nil, ""},
+	}
+	for name, tt := range tests {
+		input, err := Decompress(bytes.NewReader(tt.input))
+		assert.NoError(t, err, name)
+		assert.Equal(t, tt.compression, input.Compression, name)
+
+		decompressed, err := io.ReadAll(input.Reader)
+		assert.NoError(t, err, name)
+		if len(tt.input) > 0 {
+			assert.Equal(t, string(content), string(decompressed), name)
+		}
+		input.Close()
+	}
+}
@@ -1,53 +1,335 @@
 package data
 
 import (
-	"database/sql"
-	"encoding/csv"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/radu2020/planet/internal/storage"
 	"io"
 	"log"
 	"os"
+	"sort"
+	"sync"
+	"time"
 )
 
-// ProcessCSVRecords processes CSV records and inserts them into the database
-func ProcessCSVRecords(file *os.File, db *sql.DB, batchSize int) {
-	reader := csv.NewReader(file)
+// Options configures the load pipeline
+type Options struct {
+	BatchSize int              // Number of records per batch
+	Workers   int              // Number of goroutines validating records
+	Writers   int              // Number of goroutines inserting batches, each on its own connection
+	Writer    storage.Writer   // Writes the batches to the storage
+	Rejects   *RejectWriter    // Receives the rejected rows, may be nil
+	Repair    *RepairOptions   // Repairs footprints before validation, nil to disable
+	Timestamp *TimestampParser // Parses the timestamps, nil for RFC 3339
+	File      string           // Name of the input file, recorded with the rejected rows
 
-	// Skip header
-	_, err := reader.Read()
+	ResumeAfter     int                  // Skip the records starting on or before this line
+	Checkpoint      func(line int) error // Records that every record up to line was processed, may be nil
+	CheckpointEvery int                  // Number of batches written between checkpoints
+}
+
+// LoadError is an error tied to the line of the CSV file it occurred on
+type LoadError struct {
+	Line int
+	Err  error
+}
+
+func (e LoadError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// row is a record, the line it starts on and its position in the file. The
+// event is parsed from the record by the validators.
+type row struct {
+	seq    int64
+	line   int
+	record []string
+	event  storage.UsageEvent
+}
+
+// ProcessCSVRecords processes CSV records and writes them to the storage
+func ProcessCSVRecords(ctx context.Context, file io.Reader, opts Options) (LoadReport, error) {
+	source, err := newCSVSource(file, ColumnOptions{})
 	if err != nil {
-		log.Fatalf("Error reading header: %v", err)
-		return
+		return LoadReport{RowsRejected: map[string]int64{}}, err
 	}
+	return ProcessRecords(ctx, source, opts)
+}
 
-	var batch [][]string
+// LoadFile loads the input file at path, decompressing it when needed. The
+// records are read in the format, or in the format of the file extension when
+// it is empty.
+func LoadFile(ctx context.Context, path, format string, columns ColumnOptions, opts Options) (LoadReport, error) {
+	report := LoadReport{File: path, RowsRejected: map[string]int64{}}
+	opts.File = path
 
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
+	if format == "" {
+		var err error
+		format, err = FormatOf(path)
 		if err != nil {
-			log.Printf("Error reading line: %v", err)
-			continue
+			return report, fmt.Errorf("detecting input format: %w", err)
 		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return report, err
+	}
+	defer file.Close()
 
-		if isValidRecord(record) {
-			batch = append(batch, record)
-			if len(batch) >= batchSize {
-				if err := storage.InsertBatch(db, batch); err != nil {
-					log.Println("Batch insert error:", err)
+	input, err := Decompress(file)
+	if err != nil {
+		return report, fmt.Errorf("decompressing file: %w", err)
+	}
+	defer input.Close()
+	report.Compression = input.Compression
+
+	source, err := NewSource(format, input.Reader, columns)
+	if err != nil {
+		return report, fmt.Errorf("reading %s file: %w", format, err)
+	}
+	report, err = ProcessRecords(ctx, source, opts)
+	report.File = path
+	report.Compression = input.Compression
+	return report, err
+}
+
+// ProcessRecords processes the records of the source and writes them to the
+// storage. Reading, validating and inserting run concurrently: a reader
+// goroutine feeds the validator workers, which feed the writers through
+// bounded channels. An error is returned when the source cannot be read to
+// the end or ctx is cancelled, the report then covers the rows read until then.
+func ProcessRecords(ctx context.Context, source Source, opts Options) (LoadReport, error) {
+	start := time.Now()
+	report, err := runPipeline(ctx, source, opts)
+	report.Elapsed = time.Since(start)
+
+	for _, err := range report.Errors {
+		log.Println("Load error:", err)
+	}
+	for reason, count := range report.RowsRejected {
+		log.Printf("Rejected %d rows: %s", count, reason)
+	}
+	log.Printf("Read %d rows, %d valid, inserted %d rows, skipped %d duplicates, rejected %d rows, %d batches failed",
+		report.RowsRead, report.RowsValid, report.RowsInserted, report.Duplicates, report.Rejected(), report.BatchesFailed)
+	return report, err
+}
+
+// runPipeline reads the records of the source and loads them. It returns the
+// error that stopped the reader, if any.
+func runPipeline(ctx context.Context, source Source, opts Options) (LoadReport, error) {
+	workers := max(opts.Workers, 1)
+	writers := max(opts.Writers, 1)
+	batchSize := max(opts.BatchSize, 1)
+
+	// The channels are bounded so a slow database holds back the reader
+	rows := make(chan row, batchSize)
+	valid := make(chan row, batchSize*writers)
+
+	var mu sync.Mutex
+	report := LoadReport{RowsRejected: make(map[string]int64)}
+	var readErr error
+	progress := newProgress(opts.ResumeAfter)
+	timestamps := opts.Timestamp
+	if timestamps == nil {
+		timestamps = defaultTimestamps
+	}
+	fail := func(line int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		report.Errors = append(report.Errors, LoadError{Line: line, Err: err})
+	}
+	reject := func(seq int64, line int, fields []string, err *RecordError) {
+		mu.Lock()
+		report.RowsRejected[err.Reason]++
+		progress.done(seq, line)
+		mu.Unlock()
+
+		rejection := Rejection{File: opts.File, Line: line, Reason: err.Reason, Message: err.Message, Fields: fields}
+		if err := opts.Rejects.Write(rejection); err != nil {
+			log.Println("Failed to write rejected row:", err)
+		}
+	}
+
+	// Checkpoints
+	var checkpointMu sync.Mutex
+	saved := opts.ResumeAfter
+	checkpoint := func() {
+		if opts.Checkpoint == nil {
+			return
+		}
+		mu.Lock()
+		line := progress.line
+		mu.Unlock()
+
+		checkpointMu.Lock()
+		defer checkpointMu.Unlock()
+		if line <= saved {
+			return
+		}
+		if err := opts.Checkpoint(line); err != nil {
+			log.Println("Failed to save checkpoint:", err)
+			return
+		}
+		saved = line
+	}
+
+	// Reader
+	go func() {
+		defer close(rows)
+		var seq int64
+		for {
+			if err := ctx.Err(); err != nil {
+				readErr = err
+				return
+			}
+			record, line, err := source.Next()
+			if err == io.EOF {
+				return
+			}
+			var recordErr *RecordError
+			if err != nil && !errors.As(err, &recordErr) {
+				readErr = err
+				return
+			}
+
+			mu.Lock()
+			if line <= opts.ResumeAfter {
+				report.RowsSkipped++
+				mu.Unlock()
+				continue
+			}
+			report.RowsRead++
+			mu.Unlock()
+
+			if recordErr != nil {
+				reject(seq, line, record, recordErr)
+			} else {
+				select {
+				case rows <- row{seq: seq, line: line, record: record}:
+				case <-ctx.Done():
+					readErr = ctx.Err()
+					return
 				}
-				batch = nil
 			}
+			seq++
 		}
+	}()
+
+	// Validators
+	var validators sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		validators.Add(1)
+		go func() {
+			defer validators.Done()
+			for r := range rows {
+				event, err := parseRecord(r.record, timestamps, opts.Repair)
+				if err != nil {
+					reject(r.seq, r.line, r.record, err)
+					continue
+				}
+				event.SourceFile = opts.File
+				event.LineNo = r.line
+				r.event = event
+				valid <- r
+			}
+		}()
 	}
+	go func() {
+		validators.Wait()
+		close(valid)
+	}()
+
+	// Writers
+	var batches int
+	checkpointEvery := max(opts.CheckpointEvery, 1)
+	write := func(batch []row) {
+		defer func() {
+			mu.Lock()
+			batches++
+			due := batches%checkpointEvery == 0
+			mu.Unlock()
+			if due {
+				checkpoint()
+			}
+		}()
+
+		events := make([]storage.UsageEvent, len(batch))
+		for i, r := range batch {
+			events[i] = r.event
+		}
+
+		// An interrupted load drops its remaining batches. They are neither
+		// written nor rejected, the checkpoint stays before them.
+		drop := func() {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range batch {
+				progress.fail(r.seq)
+			}
+		}
+		if ctx.Err() != nil {
+			drop()
+			return
+		}
 
-	if len(batch) > 0 {
-		if err := storage.InsertBatch(db, batch); err != nil {
-			log.Println("Final batch insert error:", err)
+		inserted, err := opts.Writer.WriteEvents(ctx, events)
+		if err != nil && ctx.Err() != nil {
+			drop()
+			return
+		}
+		if err != nil {
+			fail(batch[0].line, fmt.Errorf("batch of %d rows: %w", len(batch), err))
+			mu.Lock()
+			report.BatchesFailed++
+			for _, r := range batch {
+				progress.fail(r.seq)
+			}
+			mu.Unlock()
+			for _, r := range batch {
+				reject(r.seq, r.line, r.record, &RecordError{Reason: ReasonDBError, Message: err.Error()})
+			}
+			return
 		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		report.RowsInserted += inserted
+		report.Duplicates += int64(len(batch)) - inserted
+		for _, r := range batch {
+			progress.done(r.seq, r.line)
+		}
+	}
+
+	var writersDone sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		writersDone.Add(1)
+		go func() {
+			defer writersDone.Done()
+			var batch []row
+			for r := range valid {
+				mu.Lock()
+				report.RowsValid++
+				mu.Unlock()
+
+				batch = append(batch, r)
+				if len(batch) >= batchSize {
+					write(batch)
+					batch = nil
+				}
+			}
+			if len(batch) > 0 {
+				write(batch)
+			}
+		}()
 	}
+	writersDone.Wait()
+	checkpoint()
+	report.LastLine = progress.line
 
-	log.Println("CSV data successfully loaded into the database!")
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+	return report, readErr
 }
@@ -0,0 +1,319 @@
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/radu2020/planet/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWriter records the written batches and fails batches holding org 13
+type fakeWriter struct {
+	mu     sync.Mutex
+	events []storage.UsageEvent
+	delay  time.Duration
+}
+
+func (f *fakeWriter) WriteEvents(ctx context.Context, batch []storage.UsageEvent) (int64, error) {
+	time.Sleep(f.delay)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, event := range batch {
+		if event.OrgID == 13 {
+			return 0, errors.New("connection reset")
+		}
+	}
+	f.events = append(f.events, batch...)
+	return int64(len(batch)), nil
+}
+
+// csvFootprint is testFootprint quoted for a CSV file
+var csvFootprint = `"` + strings.ReplaceAll(testFootprint, `"`, `""`) + `"`
+
+// csvTestSource returns a CSV source reading input
+func csvTestSource(input string) Source {
+	source, err := newCSVSource(strings.NewReader(input), ColumnOptions{})
+	if err != nil {
+		panic(err)
+	}
+	return source
+}
+
+// csvInput builds a CSV file with a header and n valid rows of org 1
+func csvInput(n int, extra ...string) string {
+	var sb strings.Builder
+	sb.WriteString("org_id,footprints_used,source_event_timestamp\n")
+	for i := 0; i < n; i++ {
+		sb.WriteString(`1,` + csvFootprint + `,2025-02-09T15:04:05Z` + "\n")
+	}
+	for _, line := range extra {
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+func TestRunPipeline(t *testing.T) {
+	input := csvInput(95,
+		`2,`+csvFootprint+`,not-a-timestamp`,
+		`13,`+csvFootprint+`,2025-02-09T15:04:05Z`,
+		`3,only-two-columns`,
+	)
+	source := csvTestSource(input)
+
+	writer := &fakeWriter{}
+	result, err := runPipeline(context.Background(), source, Options{BatchSize: 10, Workers: 3, Writers: 1, Writer: writer})
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(98), result.RowsRead)
+	assert.Equal(t, int64(96), result.RowsValid)
+	// The batch holding org 13 fails as a whole
+	assert.Equal(t, int64(90), result.RowsInserted)
+	assert.Len(t, writer.events, 90)
+	assert.Len(t, result.Errors, 1)
+	assert.Equal(t, int64(1), result.BatchesFailed)
+	assert.Contains(t, result.Errors[0].Error(), "connection reset")
+}
+
+func TestRunPipeline_OrderedErrors(t *testing.T) {
+	input := csvInput(0,
+		`13,`+csvFootprint+`,2025-02-09T15:04:05Z`,
+		`1,`+csvFootprint+`,2025-02-09T15:04:05Z`,
+		`13,`+csvFootprint+`,2025-02-09T15:04:06Z`,
+		`1,`+csvFootprint+`,2025-02-09T15:04:06Z`,
+		`13,`+csvFootprint+`,2025-02-09T15:04:07Z`,
+	)
+	source := csvTestSource(input)
+
+	writer := &fakeWriter{}
+	result, err := runPipeline(context.Background(), source, Options{BatchSize: 1, Workers: 4, Writers: 4, Writer: writer})
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(2), result.RowsInserted)
+	lines := make([]int, len(result.Errors))
+	for i, err := range result.Errors {
+		lines[i] = err.Line
+	}
+	assert.Equal(t, []int{2, 4, 6}, lines)
+}
+
+func TestRunPipeline_ParseError(t *testing.T) {
+	input := csvInput(2, `1,"unterminated,2025-02-09T15:04:05Z`)
+	source := csvTestSource(input)
+
+	var rejects bytes.Buffer
+	writer := &fakeWriter{}
+	result, err := runPipeline(context.Background(), source, Options{BatchSize: 10, Workers: 1, Writers: 1, Writer: writer, Rejects: NewRejectWriter(&rejects, false)})
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(2), result.RowsInserted)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, map[string]int64{ReasonMalformedCSV: 1}, result.RowsRejected)
+
+	var rejection Rejection
+	assert.NoError(t, json.Unmarshal(rejects.Bytes(), &rejection))
+	assert.Equal(t, 4, rejection.Line)
+	assert.Equal(t, ReasonMalformedCSV, rejection.Reason)
+}
+
+func TestRunPipeline_Rejects(t *testing.T) {
+	input := csvInput(1,
+		`2,`+csvFootprint+`,not-a-timestamp`,
+		`3,,2025-02-09T15:04:05Z`,
+		`4,"{""type"":""Point""}",2025-02-09T15:04:05Z`,
+		`5,only-two-columns`,
+		`13,`+csvFootprint+`,2025-02-09T15:04:05Z`,
+	)
+	source := csvTestSource(input)
+
+	var rejects bytes.Buffer
+	writer := &fakeWriter{}
+	result, err := runPipeline(context.Background(), source, Options{BatchSize: 1, Workers: 1, Writers: 1, Writer: writer, Rejects: NewRejectWriter(&rejects, false)})
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]int64{
+		ReasonBadTimestamp:     1,
+		ReasonEmptyField:       1,
+		ReasonBadFootprint:     1,
+		ReasonWrongColumnCount: 1,
+		ReasonDBError:          1,
+	}, result.RowsRejected)
+
+	byLine := make(map[int]Rejection)
+	decoder := json.NewDecoder(&rejects)
+	for decoder.More() {
+		var rejection Rejection
+		assert.NoError(t, decoder.Decode(&rejection))
+		byLine[rejection.Line] = rejection
+	}
+	assert.Len(t, byLine, 5)
+	assert.Equal(t, ReasonWrongColumnCount, byLine[6].Reason)
+	assert.Equal(t, []string{"5", "only-two-columns"}, byLine[6].Fields)
+	assert.Equal(t, ReasonDBError, byLine[7].Reason)
+	assert.Equal(t, "13", byLine[7].Fields[0])
+}
+
+func TestRunPipeline_Checkpoints(t *testing.T) {
+	input := csvInput(20, `13,`+csvFootprint+`,2025-02-09T15:04:05Z`, `2,`+csvFootprint+`,2025-02-09T15:04:05Z`)
+	source := csvTestSource(input)
+
+	var mu sync.Mutex
+	var checkpoints []int
+	save := func(line int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		checkpoints = append(checkpoints, line)
+		return nil
+	}
+
+	writer := &fakeWriter{delay: time.Millisecond}
+	result, err := runPipeline(context.Background(), source, Options{BatchSize: 2, Workers: 2, Writers: 3, Writer: writer, Checkpoint: save, CheckpointEvery: 3})
+	assert.NoError(t, err)
+
+	// The rows of the failed batch were not written, so the checkpoint stays
+	// before line 22 and a resumed load retries them
+	assert.Equal(t, int64(1), result.BatchesFailed)
+	assert.Less(t, result.LastLine, 22)
+	assert.True(t, len(checkpoints) > 1)
+	assert.Equal(t, result.LastLine, checkpoints[len(checkpoints)-1])
+	for i := 1; i < len(checkpoints); i++ {
+		assert.Greater(t, checkpoints[i], checkpoints[i-1])
+	}
+}
+
+func TestRunPipeline_Resume(t *testing.T) {
+	input := csvInput(10, `1,"unterminated,2025-02-09T15:04:05Z`)
+	source := csvTestSource(input)
+
+	writer := &fakeWriter{}
+	result, err := runPipeline(context.Background(), source, Options{BatchSize: 3, Workers: 1, Writers: 1, Writer: writer, ResumeAfter: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), result.RowsSkipped)
+	assert.Equal(t, int64(5), result.RowsRead)
+	assert.Equal(t, int64(4), result.RowsInserted)
+	assert.Equal(t, 12, result.LastLine)
+}
+
+// cancellingWriter writes its first batch and cancels the load while writing
+// the second one, failing it with the error of the context like a database
+// driver does
+type cancellingWriter struct {
+	fakeWriter
+	cancel  context.CancelFunc
+	batches int
+}
+
+func (w *cancellingWriter) WriteEvents(ctx context.Context, batch []storage.UsageEvent) (int64, error) {
+	w.batches++
+	if w.batches == 2 {
+		w.cancel()
+		return 0, ctx.Err()
+	}
+	return w.fakeWriter.WriteEvents(ctx, batch)
+}
+
+func TestRunPipeline_Cancelled(t *testing.T) {
+	source := csvTestSource(csvInput(100))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := &cancellingWriter{cancel: cancel}
+	var rejects bytes.Buffer
+	result, err := runPipeline(ctx, source, Options{BatchSize: 1, Workers: 1, Writers: 1, Writer: writer, Rejects: NewRejectWriter(&rejects, false)})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, result.RowsRead, int64(100))
+	assert.Equal(t, int64(1), result.RowsInserted)
+	assert.Len(t, writer.events, 1)
+	assert.Equal(t, 2, result.LastLine)
+
+	// The batches cut off by the cancellation are retried on resume, they
+	// are not rejected
+	assert.Zero(t, result.BatchesFailed)
+	assert.Zero(t, result.Rejected())
+	assert.Empty(t, result.Errors)
+	assert.Zero(t, rejects.Len())
+}
+
+// The writer sleeps to simulate a database round trip, so more writers
+// overlap more round trips
+func BenchmarkRunPipeline(b *testing.B) {
+	input := csvInput(10000)
+	for _, writers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("writers=%d", writers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				source := csvTestSource(input)
+				writer := &fakeWriter{delay: time.Millisecond}
+				_, _ = runPipeline(context.Background(), source, Options{BatchSize: 100, Workers: 4, Writers: writers, Writer: writer})
+			}
+		})
+	}
+}
+
+func TestRunPipeline_Repair(t *testing.T) {
+	unclosed := `"{""type"":""Feature"",""geometry"":{""type"":""Polygon"",""coordinates"":[[[0,0],[1,0],[1,1],[0,1]]]}}"`
+	source := csvTestSource(csvInput(0, `1,`+unclosed+`,2025-02-09T15:04:05Z`))
+
+	writer := &fakeWriter{}
+	result, err := runPipeline(context.Background(), source, Options{BatchSize: 1, Workers: 1, Writers: 1, Writer: writer, Repair: &RepairOptions{Precision: -1}, File: "sample.csv"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(1), result.RowsInserted)
+	assert.Equal(t, []string{RepairClosedRing}, writer.events[0].Footprint.Properties[RepairsProperty])
+	assert.Equal(t, "sample.csv", writer.events[0].SourceFile)
+	assert.Equal(t, 2, writer.events[0].LineNo)
+}
+
+func TestProcessCSVRecords_Sqlite(t *testing.T) {
+	db, err := storage.OpenSqlite(":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// The second run skips the rows loaded by the first
+	input := csvInput(0, `1,`+csvFootprint+`,2025-02-09T15:04:05Z`, `2,`+csvFootprint+`,2025-02-09T15:04:05Z`, `2,`+csvFootprint+`,2025-02-09T15:04:06Z`)
+	opts := Options{BatchSize: 2, Workers: 2, Writers: 2, Writer: db}
+	for _, expected := range []int64{3, 0} {
+		report, err := ProcessCSVRecords(context.Background(), strings.NewReader(input), opts)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, report.RowsInserted)
+	}
+
+	orgIDs, err := db.GetOrgIDs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, orgIDs)
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.csv.gz")
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	_, err = gz.Write([]byte(csvInput(3)))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, file.Close())
+
+	writer := &fakeWriter{}
+	report, err := LoadFile(context.Background(), path, "", ColumnOptions{}, Options{BatchSize: 2, Workers: 1, Writers: 1, Writer: writer})
+	assert.NoError(t, err)
+	assert.Equal(t, path, report.File)
+	assert.Equal(t, CompressionGzip, report.Compression)
+	assert.Equal(t, int64(3), report.RowsInserted)
+	assert.Equal(t, path, writer.events[0].SourceFile)
+
+	_, err = LoadFile(context.Background(), filepath.Join(dir, "events.txt"), "", ColumnOptions{}, Options{Writer: writer})
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// jsonField returns a field of a JSON event as text, strings are unquoted and
+// missing or null fields are empty
+func jsonField(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// ndjsonSource reads newline delimited JSON with one event per line. The
+// org_id may be a number or a string, the footprint a GeoJSON object or a
+// string holding one.
+type ndjsonSource struct {
+	reader    *bufio.Reader
+	index     map[string]int
+	keepExtra bool
+	line      int
+}
+
+func newNDJSONSource(r io.Reader, columns ColumnOptions) *ndjsonSource {
+	return &ndjsonSource{reader: bufio.NewReader(r), index: columns.fieldIndex(), keepExtra: columns.KeepExtra}
+}
+
+func (s *ndjsonSource) Next() ([]string, int, error) {
+	for {
+		text, err := s.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		if len(text) == 0 && err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		s.line++
+
+		text = bytes.TrimSpace(text)
+		if len(text) == 0 {
+			continue
+		}
+
+		var event map[string]json.RawMessage
+		if err := json.Unmarshal(text, &event); err != nil {
+			return []string{string(text)}, s.line, &RecordError{Reason: ReasonMalformedJSON, Message: err.Error(), Err: err}
+		}
+
+		record := make([]string, len(recordColumns))
+		extra := make(map[string]json.RawMessage)
+		for name, value := range event {
+			if field, ok := s.index[normalizeColumn(name)]; ok {
+				record[field] = jsonField(value)
+			} else if s.keepExtra {
+				extra[name] = value
+			}
+		}
+		if len(extra) > 0 {
+			record[1] = withProperties(record[1], extra)
+		}
+		return record, s.line, nil
+	}
+}
@@ -0,0 +1,31 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSONSource(t *testing.T) {
+	input := `{"org_id":1,"footprints_used":` + testFootprint + `,"source_event_timestamp":"2025-02-09T15:04:05Z"}
+{"org_id":"2","footprints_used":"{\"type\":\"Feature\"}","source_event_timestamp":"2025-02-09T15:04:05Z"}
+
+{"org_id":3,"footprints_used":
+{"source_event_timestamp":"2025-02-09T15:04:05Z"}`
+
+	source, err := NewSource(FormatNDJSON, strings.NewReader(input), ColumnOptions{})
+	assert.NoError(t, err)
+
+	records, lines, errs := readAll(t, source)
+	assert.Equal(t, []int{1, 2, 4, 5}, lines)
+
+	assert.Equal(t, []string{"1", testFootprint, "2025-02-09T15:04:05Z"}, records[0])
+	assert.NoError(t, errs[0])
+	assert.Equal(t, []string{"2", `{"type":"Feature"}`, "2025-02-09T15:04:05Z"}, records[1])
+
+	// Malformed lines are rejected, missing fields are left to the validators
+	assert.Equal(t, ReasonMalformedJSON, errs[2].(*RecordError).Reason)
+	assert.Equal(t, []string{"", "", "2025-02-09T15:04:05Z"}, records[3])
+	assert.NoError(t, errs[3])
+}
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetSource reads Parquet files with the org_id, footprints_used and
+// source_event_timestamp columns. Timestamps may be strings or Parquet
+// timestamps, the footprints are strings holding GeoJSON.
+type parquetSource struct {
+	reader  *parquet.Reader
+	columns []int          // column index of each record field
+	types   []parquet.Type // column type of each record field
+	rows    []parquet.Row
+	index   int
+}
+
+func newParquetSource(r io.Reader, columns ColumnOptions) (*parquetSource, error) {
+	input, size, err := readerAt(r)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parquet.OpenFile(input, size)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &parquetSource{
+		reader:  parquet.NewReader(file),
+		columns: []int{-1, -1, -1},
+		types:   make([]parquet.Type, len(recordColumns)),
+		rows:    make([]parquet.Row, 1),
+	}
+	index := columns.fieldIndex()
+	for _, path := range file.Schema().Columns() {
+		field, ok := index[normalizeColumn(path[0])]
+		if !ok || len(path) != 1 {
+			continue
+		}
+		leaf, _ := file.Schema().Lookup(path...)
+		s.columns[field] = leaf.ColumnIndex
+		s.types[field] = leaf.Node.Type()
+	}
+	for field, column := range s.columns {
+		if column < 0 {
+			name := recordColumns[field]
+			return nil, fmt.Errorf("parquet file has no %s column (accepted names: %s)", name, columns.accepted(name))
+		}
+	}
+	return s, nil
+}
+
+func (s *parquetSource) Next() ([]string, int, error) {
+	for {
+		n, err := s.reader.ReadRows(s.rows)
+		if n == 0 {
+			if err == nil {
+				continue
+			}
+			return nil, 0, err
+		}
+		s.index++
+
+		record := make([]string, len(s.columns))
+		for _, value := range s.rows[0] {
+			for i, column := range s.columns {
+				if value.Column() == column {
+					record[i] = parquetValue(value, s.types[i])
+				}
+			}
+		}
+		return record, s.index, nil
+	}
+}
+
+// parquetValue returns a value as text, timestamps are formatted as RFC 3339
+func parquetValue(value parquet.Value, typ parquet.Type) string {
+	if value.IsNull() {
+		return ""
+	}
+	if logical := typ.LogicalType(); logical != nil && logical.Timestamp != nil {
+		unit := logical.Timestamp.Unit
+		switch {
+		case unit.Millis != nil:
+			return time.UnixMilli(value.Int64()).UTC().Format(time.RFC3339Nano)
+		case unit.Micros != nil:
+			return time.UnixMicro(value.Int64()).UTC().Format(time.RFC3339Nano)
+		default:
+			return time.Unix(0, value.Int64()).UTC().Format(time.RFC3339Nano)
+		}
+	}
+
+	switch value.Kind() {
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(value.ByteArray())
+	case parquet.Int32:
+		return strconv.FormatInt(int64(value.Int32()), 10)
+	case parquet.Int64:
+		return strconv.FormatInt(value.Int64(), 10)
+	default:
+		return value.String()
+	}
+}
+
+// readerAt returns r as an io.ReaderAt and its size. Parquet files are read
+// from the end, inputs that cannot seek are read into memory.
+func readerAt(r io.Reader) (io.ReaderAt, int64, error) {
+	if f, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, err
+		}
+		return f, size, nil
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(content), int64(len(content)), nil
+}
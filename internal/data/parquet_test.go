@@ -0,0 +1,48 @@
+package data
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParquetSource(t *testing.T) {
+	type event struct {
+		OrgID     int64     `parquet:"org_id"`
+		Footprint string    `parquet:"footprints_used"`
+		Timestamp time.Time `parquet:"source_event_timestamp,timestamp(millisecond)"`
+	}
+	timestamp := time.Date(2025, 2, 9, 15, 4, 5, 0, time.UTC)
+
+	var file bytes.Buffer
+	err := parquet.Write(&file, []event{
+		{OrgID: 1, Footprint: testFootprint, Timestamp: timestamp},
+		{OrgID: 2, Footprint: `{"type":"Feature"}`, Timestamp: timestamp.Add(time.Hour)},
+	})
+	assert.NoError(t, err)
+
+	source, err := NewSource(FormatParquet, bytes.NewReader(file.Bytes()), ColumnOptions{})
+	assert.NoError(t, err)
+
+	records, lines, _ := readAll(t, source)
+	assert.Equal(t, []int{1, 2}, lines)
+	assert.Equal(t, []string{"1", testFootprint, "2025-02-09T15:04:05Z"}, records[0])
+	assert.Equal(t, []string{"2", `{"type":"Feature"}`, "2025-02-09T16:04:05Z"}, records[1])
+}
+
+func TestParquetSource_MissingColumn(t *testing.T) {
+	type event struct {
+		OrgID int64 `parquet:"org_id"`
+	}
+
+	var file bytes.Buffer
+	assert.NoError(t, parquet.Write(&file, []event{{OrgID: 1}}))
+
+	_, err := NewSource(FormatParquet, &file, ColumnOptions{})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "footprints_used"))
+}
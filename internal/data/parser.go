@@ -1,45 +1,74 @@
 package data
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"github.com/radu2020/planet/internal/storage"
+	"strconv"
 	"strings"
-	"time"
 )
 
-// isValidRecord validates if a record is well-formed
-func isValidRecord(record []string) bool {
+// Reason codes of rejected rows
+const (
+	ReasonMalformedCSV     = "malformed_csv"
+	ReasonMalformedJSON    = "malformed_json"
+	ReasonWrongColumnCount = "wrong_column_count"
+	ReasonEmptyField       = "empty_field"
+	ReasonBadOrgID         = "bad_org_id"
+	ReasonBadFootprint     = "bad_footprint"
+	ReasonBadTimestamp     = "bad_timestamp"
+	ReasonFutureTimestamp  = "future_timestamp"
+	ReasonDBError          = "db_error"
+)
+
+// RecordError describes why a record was rejected
+type RecordError struct {
+	Reason  string
+	Message string
+	Err     error // underlying validation error, if any
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Message)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// parseRecord checks a record and parses it into a usage event, or returns
+// the first rule it breaks. The footprint is repaired before it is validated
+// when repair is set. The caller fills in where the event was read from.
+func parseRecord(record []string, timestamps *TimestampParser, repair *RepairOptions) (storage.UsageEvent, *RecordError) {
 	if len(record) != 3 {
-		log.Println("Invalid row. Each row must have exactly 3 columns")
-		return false
+		return storage.UsageEvent{}, &RecordError{Reason: ReasonWrongColumnCount, Message: "Each row must have exactly 3 columns"}
 	}
 
 	for _, value := range record {
 		if strings.TrimSpace(value) == "" {
-			log.Println("Invalid row. Columns cannot be empty")
-			return false
+			return storage.UsageEvent{}, &RecordError{Reason: ReasonEmptyField, Message: "Columns cannot be empty"}
 		}
 	}
 
-	if !isValidFootprintFormat(record[1]) {
-		log.Println("Skipping invalid footprint format:", record[1])
-		return false
+	// The org_id column is a 32 bit integer
+	orgID, err := strconv.ParseInt(strings.TrimSpace(record[0]), 10, 32)
+	if err != nil {
+		return storage.UsageEvent{}, &RecordError{Reason: ReasonBadOrgID, Message: "Invalid org_id: " + record[0], Err: err}
 	}
 
-	if !isValidTimestamp(record[2]) {
-		log.Println("Skipping invalid timestamp:", record[2])
-		return false
+	footprint, err := ValidateFootprint(record[1], repair)
+	if err != nil {
+		return storage.UsageEvent{}, &RecordError{Reason: ReasonBadFootprint, Message: "Invalid footprint: " + err.Error(), Err: err}
 	}
 
-	return true
-}
-
-// isValidFootprintFormat checks if the footprint is in the correct JSON format
-func isValidFootprintFormat(footprint string) bool {
-	return strings.HasPrefix(footprint, `{"type":"Feature"`)
-}
+	timestamp, err := timestamps.Parse(record[2])
+	if err != nil {
+		var recordErr *RecordError
+		if errors.As(err, &recordErr) {
+			return storage.UsageEvent{}, recordErr
+		}
+		return storage.UsageEvent{}, &RecordError{Reason: ReasonBadTimestamp, Message: "Invalid timestamp: " + record[2], Err: err}
+	}
 
-// isValidTimestamp checks if the timestamp is in the correct RFC3339 format
-func isValidTimestamp(timestampStr string) bool {
-	_, err := time.Parse(time.RFC3339, timestampStr)
-	return err == nil
+	return storage.UsageEvent{OrgID: orgID, Footprint: footprint, Timestamp: timestamp}, nil
 }
@@ -2,16 +2,22 @@ package data
 
 import (
 	"fmt"
+	"github.com/paulmach/orb"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
-func TestIsValidRecord(t *testing.T) {
+// testFootprint is a valid footprint
+const testFootprint = `{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[13.34,52.45],[13.35,52.45],[13.35,52.46],[13.34,52.45]]]},"properties":{}}`
+
+func TestParseRecord_Valid(t *testing.T) {
 	tests := []struct {
 		record   []string
 		expected bool
 	}{
-		{[]string{"1", `{"type":"Feature"}`, "2025-02-09T15:04:05Z"}, true},
+		{[]string{"1", testFootprint, "2025-02-09T15:04:05Z"}, true},
+		{[]string{"1", `{"type":"Feature"}`, "2025-02-09T15:04:05Z"}, false},
 		{[]string{"1", "", "2025-02-09T15:04:05Z"}, false},
 		{[]string{"1", `{"type":"Feature"}`, "invalid_timestamp"}, false},
 		{[]string{`{"type":"Feature"}`, "2025-02-09T15:04:05Z"}, false},
@@ -19,8 +25,38 @@ func TestIsValidRecord(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf("Testing record %v", tt.record), func(t *testing.T) {
-			result := isValidRecord(tt.record)
-			assert.Equal(t, tt.expected, result)
+			_, err := parseRecord(tt.record, defaultTimestamps, nil)
+			assert.Equal(t, tt.expected, err == nil)
+		})
+	}
+}
+
+func TestParseRecord_Invalid(t *testing.T) {
+	tests := []struct {
+		record []string
+		reason string
+	}{
+		{[]string{"1", `{"type":"Feature"}`}, ReasonWrongColumnCount},
+		{[]string{"1", " ", "2025-02-09T15:04:05Z"}, ReasonEmptyField},
+		{[]string{"1", `{"type":"Point"}`, "2025-02-09T15:04:05Z"}, ReasonBadFootprint},
+		{[]string{"1", testFootprint, "09/02/2025"}, ReasonBadTimestamp},
+		{[]string{"org-1", testFootprint, "2025-02-09T15:04:05Z"}, ReasonBadOrgID},
+		{[]string{"4294967296", testFootprint, "2025-02-09T15:04:05Z"}, ReasonBadOrgID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			_, err := parseRecord(tt.record, defaultTimestamps, nil)
+			assert.NotNil(t, err)
+			assert.Equal(t, tt.reason, err.Reason)
 		})
 	}
 }
+
+func TestParseRecord(t *testing.T) {
+	event, err := parseRecord([]string{" 42 ", testFootprint, "2025-02-09T16:04:05+01:00"}, defaultTimestamps, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), event.OrgID)
+	assert.Equal(t, orb.Polygon{{{13.34, 52.45}, {13.35, 52.45}, {13.35, 52.46}, {13.34, 52.45}}}, event.Footprint.Geometry)
+	assert.Equal(t, time.Date(2025, 2, 9, 15, 4, 5, 0, time.UTC), event.Timestamp)
+}
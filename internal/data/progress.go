@@ -0,0 +1,38 @@
+package data
+
+import "math"
+
+// progress tracks the line up to which every record was processed. Writers
+// finish batches out of order, so a record only counts once all records read
+// before it have been inserted or rejected as well. Records that were not
+// written stop the progress, so a resumed load retries them.
+type progress struct {
+	next     int64         // sequence number of the first unfinished record
+	finished map[int64]int // lines of the finished records after next
+	line     int           // line of the record before next
+	stop     int64         // sequence number of the first record not written
+}
+
+func newProgress(line int) *progress {
+	return &progress{finished: make(map[int64]int), line: line, stop: math.MaxInt64}
+}
+
+// fail marks the record with the sequence number as not written. The line
+// stays before it for the rest of the load.
+func (p *progress) fail(seq int64) {
+	p.stop = min(p.stop, seq)
+}
+
+// done marks the record with the sequence number as processed
+func (p *progress) done(seq int64, line int) {
+	p.finished[seq] = line
+	for p.next < p.stop {
+		line, ok := p.finished[p.next]
+		if !ok {
+			return
+		}
+		delete(p.finished, p.next)
+		p.line = line
+		p.next++
+	}
+}
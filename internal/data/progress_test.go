@@ -0,0 +1,36 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	p := newProgress(10)
+	assert.Equal(t, 10, p.line)
+
+	// Records finishing ahead of an unfinished one do not move the line
+	p.done(1, 12)
+	p.done(2, 15)
+	assert.Equal(t, 10, p.line)
+
+	p.done(0, 11)
+	assert.Equal(t, 15, p.line)
+	assert.Empty(t, p.finished)
+
+	p.done(3, 16)
+	assert.Equal(t, 16, p.line)
+}
+
+func TestProgress_Fail(t *testing.T) {
+	p := newProgress(10)
+	p.done(0, 11)
+
+	// A record that was not written holds the line back for good
+	p.fail(2)
+	p.done(2, 13)
+	p.done(1, 12)
+	p.done(3, 14)
+	assert.Equal(t, 12, p.line)
+}
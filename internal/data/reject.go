@@ -0,0 +1,116 @@
+package data
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rejection is a row that could not be loaded, with the reason it was rejected
+type Rejection struct {
+	File    string   `json:"file,omitempty"`
+	Line    int      `json:"line"`
+	Reason  string   `json:"reason"`
+	Message string   `json:"message"`
+	Fields  []string `json:"fields"`
+}
+
+// RejectWriter writes rejected rows to a dead-letter file so they can be fixed
+// and replayed. It is safe for concurrent use. A nil RejectWriter discards rows.
+type RejectWriter struct {
+	mu     sync.Mutex
+	closer io.Closer
+	csv    *csv.Writer
+	json   *json.Encoder
+}
+
+// CreateRejectFile creates the reject file at path. Files with a .csv
+// extension are written as CSV, all others as JSON lines.
+func CreateRejectFile(path string) (*RejectWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := NewRejectWriter(file, strings.EqualFold(filepath.Ext(path), ".csv"))
+	rw.closer = file
+	return rw, nil
+}
+
+// OpenRejectFile opens the reject file at path and appends to it, so a resumed
+// load keeps the rows rejected before its checkpoint. The CSV header is only
+// written to an empty file.
+func OpenRejectFile(path string) (*RejectWriter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	rw := newRejectWriter(file, strings.EqualFold(filepath.Ext(path), ".csv"), info.Size() == 0)
+	rw.closer = file
+	return rw, nil
+}
+
+// NewRejectWriter writes rejections to w, as CSV with a header when asCSV is
+// set and as JSON lines otherwise
+func NewRejectWriter(w io.Writer, asCSV bool) *RejectWriter {
+	return newRejectWriter(w, asCSV, true)
+}
+
+// newRejectWriter is NewRejectWriter, the CSV header is left out unless header
+// is set
+func newRejectWriter(w io.Writer, asCSV, header bool) *RejectWriter {
+	if !asCSV {
+		return &RejectWriter{json: json.NewEncoder(w)}
+	}
+
+	rw := &RejectWriter{csv: csv.NewWriter(w)}
+	if header {
+		_ = rw.csv.Write([]string{"file", "line", "reason", "message", "fields..."})
+	}
+	return rw
+}
+
+// Write appends a rejection to the file
+func (rw *RejectWriter) Write(r Rejection) error {
+	if rw == nil {
+		return nil
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.json != nil {
+		return rw.json.Encode(r)
+	}
+	return rw.csv.Write(append([]string{r.File, strconv.Itoa(r.Line), r.Reason, r.Message}, r.Fields...))
+}
+
+// Close flushes the file and closes it
+func (rw *RejectWriter) Close() error {
+	if rw == nil {
+		return nil
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.csv != nil {
+		rw.csv.Flush()
+		if err := rw.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if rw.closer != nil {
+		return rw.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRejectFile_CSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rejects.csv")
+
+	rejects, err := CreateRejectFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, rejects.Write(Rejection{File: "usage.csv", Line: 7, Reason: ReasonEmptyField, Message: "Columns cannot be empty", Fields: []string{"1", "", "2025-02-09T15:04:05Z"}}))
+	assert.NoError(t, rejects.Close())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file,line,reason,message,fields...\nusage.csv,7,empty_field,Columns cannot be empty,1,,2025-02-09T15:04:05Z\n", string(content))
+}
+
+func TestCreateRejectFile_JSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rejects.jsonl")
+
+	rejects, err := CreateRejectFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, rejects.Write(Rejection{Line: 3, Reason: ReasonBadTimestamp, Message: "Invalid timestamp: x", Fields: []string{"1", "{}", "x"}}))
+	assert.NoError(t, rejects.Close())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"line":3,"reason":"bad_timestamp","message":"Invalid timestamp: x","fields":["1","{}","x"]}`, string(content))
+}
+
+func TestOpenRejectFile_Appends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rejects.csv")
+
+	for _, line := range []int{7, 12} {
+		rejects, err := OpenRejectFile(path)
+		assert.NoError(t, err)
+		assert.NoError(t, rejects.Write(Rejection{File: "usage.csv", Line: line, Reason: ReasonEmptyField, Message: "Columns cannot be empty", Fields: []string{"1", ""}}))
+		assert.NoError(t, rejects.Close())
+	}
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file,line,reason,message,fields...\nusage.csv,7,empty_field,Columns cannot be empty,1,\nusage.csv,12,empty_field,Columns cannot be empty,1,\n", string(content))
+}
+
+func TestRejectWriter_Nil(t *testing.T) {
+	var rejects *RejectWriter
+	assert.NoError(t, rejects.Write(Rejection{Line: 1}))
+	assert.NoError(t, rejects.Close())
+}
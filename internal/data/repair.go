@@ -0,0 +1,103 @@
+package data
+
+import (
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// RepairsProperty is the feature property listing the repairs applied
+const RepairsProperty = "_repairs"
+
+// Repairs applied to footprints
+const (
+	RepairRoundedCoordinates = "rounded_coordinates"
+	RepairDuplicateVertices  = "removed_duplicate_vertices"
+	RepairClosedRing         = "closed_ring"
+	RepairWinding            = "fixed_winding"
+)
+
+// RepairOptions configures the repair of footprints
+type RepairOptions struct {
+	Precision int // Decimal places coordinates are rounded to, negative to keep them as is
+}
+
+// RepairFeature fixes common problems of a Polygon or MultiPolygon feature in
+// place: it rounds coordinates, removes consecutive duplicate vertices, closes
+// unclosed rings and enforces the right-hand rule of RFC 7946, with exterior
+// rings counterclockwise and holes clockwise. The repairs applied are returned
+// and listed in the _repairs property of the feature.
+func RepairFeature(f *geojson.Feature, opts RepairOptions) []string {
+	var polygons []orb.Polygon
+	switch g := f.Geometry.(type) {
+	case orb.Polygon:
+		polygons = []orb.Polygon{g}
+	case orb.MultiPolygon:
+		polygons = g
+	default:
+		return nil
+	}
+
+	applied := make(map[string]bool)
+	for _, polygon := range polygons {
+		for i := range polygon {
+			polygon[i] = repairRing(polygon[i], i == 0, opts, applied)
+		}
+	}
+
+	// Report the repairs in the order they were applied
+	var repairs []string
+	for _, repair := range []string{RepairRoundedCoordinates, RepairDuplicateVertices, RepairClosedRing, RepairWinding} {
+		if applied[repair] {
+			repairs = append(repairs, repair)
+		}
+	}
+	if len(repairs) > 0 {
+		if f.Properties == nil {
+			f.Properties = geojson.Properties{}
+		}
+		f.Properties[RepairsProperty] = repairs
+	}
+	return repairs
+}
+
+// repairRing repairs a single ring and marks the repairs applied
+func repairRing(ring orb.Ring, exterior bool, opts RepairOptions, applied map[string]bool) orb.Ring {
+	if opts.Precision >= 0 {
+		factor := math.Pow10(opts.Precision)
+		for i, point := range ring {
+			rounded := orb.Point{math.Round(point[0]*factor) / factor, math.Round(point[1]*factor) / factor}
+			if rounded != point {
+				ring[i] = rounded
+				applied[RepairRoundedCoordinates] = true
+			}
+		}
+	}
+
+	deduplicated := ring[:0]
+	for i, point := range ring {
+		if i > 0 && point == deduplicated[len(deduplicated)-1] {
+			applied[RepairDuplicateVertices] = true
+			continue
+		}
+		deduplicated = append(deduplicated, point)
+	}
+	ring = deduplicated
+
+	if len(ring) > 0 && !ring.Closed() {
+		ring = append(ring, ring[0])
+		applied[RepairClosedRing] = true
+	}
+
+	// Rings too short to have an orientation are left for validation to reject
+	if len(ring) >= minRingVertices {
+		orientation := ring.Orientation()
+		if (exterior && orientation == orb.CW) || (!exterior && orientation == orb.CCW) {
+			ring.Reverse()
+			applied[RepairWinding] = true
+		}
+	}
+
+	return ring
+}
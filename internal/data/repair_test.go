@@ -0,0 +1,77 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepairFeature(t *testing.T) {
+	// Clockwise exterior ring, unclosed, with a duplicate vertex
+	f := geojson.NewFeature(orb.Polygon{{
+		{0, 0}, {0, 1}, {0, 1}, {1, 1}, {1, 0},
+	}})
+
+	repairs := RepairFeature(f, RepairOptions{Precision: -1})
+
+	assert.Equal(t, []string{RepairDuplicateVertices, RepairClosedRing, RepairWinding}, repairs)
+	assert.Equal(t, repairs, f.Properties[RepairsProperty])
+
+	ring := f.Geometry.(orb.Polygon)[0]
+	assert.Equal(t, orb.Ring{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}, ring)
+	assert.Equal(t, orb.CCW, ring.Orientation())
+}
+
+func TestRepairFeature_Holes(t *testing.T) {
+	// Both rings are counterclockwise, the hole must be clockwise
+	f := geojson.NewFeature(orb.MultiPolygon{{
+		{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}},
+		{{1, 1}, {2, 1}, {2, 2}, {1, 2}, {1, 1}},
+	}})
+
+	repairs := RepairFeature(f, RepairOptions{Precision: -1})
+
+	assert.Equal(t, []string{RepairWinding}, repairs)
+	polygon := f.Geometry.(orb.MultiPolygon)[0]
+	assert.Equal(t, orb.CCW, polygon[0].Orientation())
+	assert.Equal(t, orb.CW, polygon[1].Orientation())
+}
+
+func TestRepairFeature_Precision(t *testing.T) {
+	f := geojson.NewFeature(orb.Polygon{{
+		{13.34000001, 52.45}, {13.35, 52.45}, {13.35, 52.46}, {13.34, 52.45},
+	}})
+
+	repairs := RepairFeature(f, RepairOptions{Precision: 6})
+
+	// Rounding makes the ring closed again
+	assert.Equal(t, []string{RepairRoundedCoordinates}, repairs)
+	assert.Equal(t, orb.Point{13.34, 52.45}, f.Geometry.(orb.Polygon)[0][0])
+}
+
+func TestRepairFeature_NothingToRepair(t *testing.T) {
+	f, err := ValidateFootprint(testFootprint, nil)
+	assert.NoError(t, err)
+
+	repairs := RepairFeature(f, RepairOptions{Precision: 7})
+
+	assert.Empty(t, repairs)
+	assert.NotContains(t, f.Properties, RepairsProperty)
+}
+
+func TestParseRecord_Repair(t *testing.T) {
+	footprint := `{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1]]]},"properties":{"source":"a"}}`
+	record := []string{"1", footprint, "2025-02-09T15:04:05Z"}
+
+	event, err := parseRecord(record, defaultTimestamps, &RepairOptions{Precision: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, "a", event.Footprint.Properties["source"])
+	assert.Equal(t, []string{RepairClosedRing}, event.Footprint.Properties[RepairsProperty])
+	assert.NoError(t, validateFeature(event.Footprint))
+
+	// Without repair the unclosed ring is rejected
+	_, err = parseRecord(record, defaultTimestamps, nil)
+	assert.Equal(t, ReasonBadFootprint, err.Reason)
+}
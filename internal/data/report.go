@@ -0,0 +1,76 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// LoadReport summarizes a load
+type LoadReport struct {
+	File          string           `json:"file,omitempty"`
+	Compression   string           `json:"compression,omitempty"`
+	RowsSkipped   int64            `json:"rows_skipped,omitempty"` // before the line a resumed load started after
+	RowsRead      int64            `json:"rows_read"`
+	RowsValid     int64            `json:"rows_valid"`
+	RowsRejected  map[string]int64 `json:"rows_rejected"` // by reason
+	RowsInserted  int64            `json:"rows_inserted"`
+	Duplicates    int64            `json:"duplicates"`
+	BatchesFailed int64            `json:"batches_failed"`
+	RolledBack    bool             `json:"rolled_back,omitempty"` // an atomic load discarded its rows
+	LastLine      int              `json:"last_line,omitempty"`   // every record up to this line was processed
+	Elapsed       time.Duration    `json:"-"`
+	Errors        []LoadError      `json:"errors,omitempty"` // ordered by line
+	Error         string           `json:"error,omitempty"`  // the error that stopped the load
+}
+
+// Add adds the counts of another report, as for the total of several files
+func (r *LoadReport) Add(other LoadReport) {
+	if r.RowsRejected == nil {
+		r.RowsRejected = make(map[string]int64)
+	}
+	r.RowsSkipped += other.RowsSkipped
+	r.RowsRead += other.RowsRead
+	r.RowsValid += other.RowsValid
+	for reason, count := range other.RowsRejected {
+		r.RowsRejected[reason] += count
+	}
+	r.RowsInserted += other.RowsInserted
+	r.Duplicates += other.Duplicates
+	r.BatchesFailed += other.BatchesFailed
+	r.Elapsed += other.Elapsed
+}
+
+// Rejected returns the number of rejected rows
+func (r LoadReport) Rejected() int64 {
+	var total int64
+	for _, count := range r.RowsRejected {
+		total += count
+	}
+	return total
+}
+
+// FailureRate returns the share of the rows read that were rejected
+func (r LoadReport) FailureRate() float64 {
+	if r.RowsRead == 0 {
+		return 0
+	}
+	return float64(r.Rejected()) / float64(r.RowsRead)
+}
+
+// MarshalJSON adds the elapsed seconds and the failure rate to the report
+func (r LoadReport) MarshalJSON() ([]byte, error) {
+	type report LoadReport
+	return json.Marshal(struct {
+		report
+		ElapsedSeconds float64 `json:"elapsed_seconds"`
+		FailureRate    float64 `json:"failure_rate"`
+	}{report(r), r.Elapsed.Seconds(), r.FailureRate()})
+}
+
+// MarshalJSON encodes the error as its line and message
+func (e LoadError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Line  int    `json:"line"`
+		Error string `json:"error"`
+	}{e.Line, e.Err.Error()})
+}
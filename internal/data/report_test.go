@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadReport_FailureRate(t *testing.T) {
+	assert.Equal(t, 0.0, LoadReport{}.FailureRate())
+
+	report := LoadReport{
+		RowsRead:     200,
+		RowsRejected: map[string]int64{ReasonBadTimestamp: 3, ReasonDBError: 7},
+	}
+	assert.Equal(t, int64(10), report.Rejected())
+	assert.Equal(t, 0.05, report.FailureRate())
+}
+
+func TestLoadReport_MarshalJSON(t *testing.T) {
+	report := LoadReport{
+		RowsRead:      4,
+		RowsValid:     3,
+		RowsRejected:  map[string]int64{ReasonDBError: 1},
+		RowsInserted:  2,
+		BatchesFailed: 1,
+		LastLine:      5,
+		Elapsed:       1500 * time.Millisecond,
+		Errors:        []LoadError{{Line: 3, Err: errors.New("connection reset")}},
+	}
+
+	encoded, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"rows_read": 4,
+		"rows_valid": 3,
+		"rows_rejected": {"db_error": 1},
+		"rows_inserted": 2,
+		"duplicates": 0,
+		"batches_failed": 1,
+		"last_line": 5,
+		"errors": [{"line": 3, "error": "connection reset"}],
+		"elapsed_seconds": 1.5,
+		"failure_rate": 0.25
+	}`, string(encoded))
+}
+
+func TestLoadReport_Add(t *testing.T) {
+	var total LoadReport
+	total.Add(LoadReport{File: "a.csv", RowsRead: 3, RowsInserted: 2, RowsRejected: map[string]int64{ReasonBadTimestamp: 1}})
+	total.Add(LoadReport{File: "b.csv", RowsRead: 5, RowsInserted: 4, RowsRejected: map[string]int64{ReasonBadTimestamp: 1}, BatchesFailed: 1})
+
+	assert.Equal(t, "", total.File)
+	assert.Equal(t, int64(8), total.RowsRead)
+	assert.Equal(t, int64(6), total.RowsInserted)
+	assert.Equal(t, int64(1), total.BatchesFailed)
+	assert.Equal(t, map[string]int64{ReasonBadTimestamp: 2}, total.RowsRejected)
+}
+
+func TestProcessCSVRecords(t *testing.T) {
+	writer := &fakeWriter{}
+	input := csvInput(3, `13,`+csvFootprint+`,2025-02-09T15:04:05Z`)
+
+	report, err := ProcessCSVRecords(context.Background(), strings.NewReader(input), Options{BatchSize: 1, Workers: 1, Writers: 1, Writer: writer})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), report.RowsRead)
+	assert.Equal(t, int64(3), report.RowsInserted)
+	assert.Equal(t, int64(1), report.BatchesFailed)
+	assert.Equal(t, 0.25, report.FailureRate())
+	assert.True(t, report.Elapsed > 0)
+}
+
+func TestProcessCSVRecords_EmptyFile(t *testing.T) {
+	_, err := ProcessCSVRecords(context.Background(), strings.NewReader(""), Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Formats of the input files
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatGeoJSON = "geojson"
+	FormatParquet = "parquet"
+)
+
+// recordColumns are the fields of a record, in order
+var recordColumns = []string{"org_id", "footprints_used", "source_event_timestamp"}
+
+// Source reads the records of an input file. A record holds the org_id, the
+// footprint and the timestamp of a usage event, in that order.
+type Source interface {
+	// Next returns the next record and where it starts: its line, or its
+	// index for formats that are not line based. It returns io.EOF after the
+	// last record, and a *RecordError with the raw fields for a record that
+	// cannot be decoded. Reading can continue after a *RecordError.
+	Next() (record []string, line int, err error)
+}
+
+// FormatOf returns the format of a file from its extension, ignoring the
+// extension of a compressed file such as .gz
+func FormatOf(path string) (string, error) {
+	path = strings.ToLower(path)
+	for _, ext := range compressionExtensions {
+		path = strings.TrimSuffix(path, ext)
+	}
+
+	switch ext := filepath.Ext(path); ext {
+	case ".csv":
+		return FormatCSV, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, nil
+	case ".geojson", ".json":
+		return FormatGeoJSON, nil
+	case ".parquet":
+		return FormatParquet, nil
+	default:
+		return "", fmt.Errorf("unknown file extension %q", ext)
+	}
+}
+
+// NewSource returns a source reading r in the format, finding the fields by
+// their column names
+func NewSource(format string, r io.Reader, columns ColumnOptions) (Source, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVSource(r, columns)
+	case FormatNDJSON:
+		return newNDJSONSource(r, columns), nil
+	case FormatGeoJSON:
+		return newGeoJSONSource(r, columns)
+	case FormatParquet:
+		return newParquetSource(r, columns)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// csvSource reads CSV files whose header names the org_id, footprints_used
+// and source_event_timestamp columns, in any order
+type csvSource struct {
+	reader  *csv.Reader
+	mapping columnMapping
+	columns int
+}
+
+func newCSVSource(r io.Reader, columns ColumnOptions) (*csvSource, error) {
+	reader := csv.NewReader(r)
+	// Rows are checked against the header below
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	mapping, err := mapColumns(header, columns)
+	if err != nil {
+		return nil, err
+	}
+	return &csvSource{reader: reader, mapping: mapping, columns: len(header)}, nil
+}
+
+func (s *csvSource) Next() ([]string, int, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if !errors.As(err, &parseErr) {
+			return nil, 0, err
+		}
+		return record, parseErr.StartLine, &RecordError{Reason: ReasonMalformedCSV, Message: err.Error()}
+	}
+
+	line, _ := s.reader.FieldPos(0)
+	if len(record) != s.columns {
+		message := fmt.Sprintf("Each row must have exactly %d columns", s.columns)
+		return record, line, &RecordError{Reason: ReasonWrongColumnCount, Message: message}
+	}
+	return s.mapping.record(record), line, nil
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readAll reads the records of the source until it ends
+func readAll(t *testing.T, source Source) (records [][]string, lines []int, errs []error) {
+	for {
+		record, line, err := source.Next()
+		if err == io.EOF {
+			return records, lines, errs
+		}
+		if _, ok := err.(*RecordError); !ok && err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		records = append(records, record)
+		lines = append(lines, line)
+		errs = append(errs, err)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]string{
+		"data/sample.csv":        FormatCSV,
+		"events.ndjson":          FormatNDJSON,
+		"events.jsonl":           FormatNDJSON,
+		"footprints.geojson":     FormatGeoJSON,
+		"footprints.json":        FormatGeoJSON,
+		"/exports/usage.PARQUET": FormatParquet,
+	}
+	for path, expected := range tests {
+		format, err := FormatOf(path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, expected, format, path)
+	}
+
+	_, err := FormatOf("usage.xlsx")
+	assert.Error(t, err)
+}
+
+func TestNewSource_UnknownFormat(t *testing.T) {
+	_, err := NewSource("xml", strings.NewReader(""), ColumnOptions{})
+	assert.Error(t, err)
+}
+
+func TestCSVSource(t *testing.T) {
+	input := csvInput(1, `2,"unterminated,2025-02-09T15:04:05Z`)
+	source, err := NewSource(FormatCSV, strings.NewReader(input), ColumnOptions{})
+	assert.NoError(t, err)
+
+	records, lines, errs := readAll(t, source)
+	assert.Len(t, records, 2)
+	assert.Equal(t, []int{2, 3}, lines)
+	assert.Equal(t, "1", records[0][0])
+	assert.NoError(t, errs[0])
+	assert.Equal(t, ReasonMalformedCSV, errs[1].(*RecordError).Reason)
+}
+
+func TestCSVSource_NoHeader(t *testing.T) {
+	_, err := NewSource(FormatCSV, strings.NewReader(""), ColumnOptions{})
+	assert.Error(t, err)
+}
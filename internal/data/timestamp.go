@@ -0,0 +1,145 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Named timestamp layouts, other layouts are Go time layouts
+const (
+	LayoutRFC3339     = "rfc3339"  // 2025-02-09T15:04:05Z, with optional fractional seconds
+	LayoutDateTime    = "datetime" // 2025-02-09 15:04:05
+	LayoutEpochSecond = "epoch_s"  // 1739113445, seconds since the Unix epoch
+	LayoutEpochMilli  = "epoch_ms" // 1739113445000, milliseconds since the Unix epoch
+	LayoutISOWeek     = "iso_week" // 2025-W06-7 or 2025-W06-7T15:04:05Z
+)
+
+// maxEpochSeconds bounds epoch_s values, so larger values are left to
+// epoch_ms when both layouts are accepted
+const maxEpochSeconds = 1e11
+
+// isoWeekDate matches ISO week dates in the extended and basic formats
+var isoWeekDate = regexp.MustCompile(`^(\d{4})-?W(\d{2})-?([1-7])$`)
+
+// TimestampOptions configures how timestamps are parsed
+type TimestampOptions struct {
+	Layouts   []string       // Layouts tried in order, defaults to rfc3339
+	Location  *time.Location // Zone of the timestamps without one, defaults to UTC
+	MaxFuture time.Duration  // Timestamps further in the future are rejected, 0 to accept them
+}
+
+// TimestampParser parses timestamps in the accepted layouts
+type TimestampParser struct {
+	layouts   []string
+	location  *time.Location
+	maxFuture time.Duration
+	now       func() time.Time
+}
+
+// ParseTimestampLayouts parses a list of layouts separated by semicolons,
+// such as "rfc3339;epoch_ms;2006-01-02 15:04:05"
+func ParseTimestampLayouts(s string) []string {
+	var layouts []string
+	for _, layout := range strings.Split(s, ";") {
+		if layout = strings.TrimSpace(layout); layout != "" {
+			layouts = append(layouts, layout)
+		}
+	}
+	return layouts
+}
+
+// NewTimestampParser returns a parser for the options
+func NewTimestampParser(opts TimestampOptions) *TimestampParser {
+	p := &TimestampParser{layouts: opts.Layouts, location: opts.Location, maxFuture: opts.MaxFuture, now: time.Now}
+	if len(p.layouts) == 0 {
+		p.layouts = []string{LayoutRFC3339}
+	}
+	if p.location == nil {
+		p.location = time.UTC
+	}
+	return p
+}
+
+// defaultTimestamps parses RFC 3339 timestamps
+var defaultTimestamps = NewTimestampParser(TimestampOptions{})
+
+// Parse parses a timestamp with the first layout that accepts it and returns
+// it in UTC. A *RecordError tells why a timestamp was rejected.
+func (p *TimestampParser) Parse(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range p.layouts {
+		t, err := p.parseLayout(layout, value)
+		if err != nil {
+			continue
+		}
+		if p.maxFuture > 0 && t.After(p.now().Add(p.maxFuture)) {
+			return time.Time{}, &RecordError{
+				Reason:  ReasonFutureTimestamp,
+				Message: fmt.Sprintf("Timestamp %s is more than %s in the future", value, p.maxFuture),
+			}
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, &RecordError{Reason: ReasonBadTimestamp, Message: "Invalid timestamp: " + value}
+}
+
+func (p *TimestampParser) parseLayout(layout, value string) (time.Time, error) {
+	switch layout {
+	case LayoutRFC3339:
+		return time.Parse(time.RFC3339, value)
+	case LayoutDateTime:
+		return time.ParseInLocation(time.DateTime, value, p.location)
+	case LayoutEpochSecond:
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.Abs(seconds) >= maxEpochSeconds {
+			return time.Time{}, fmt.Errorf("invalid epoch seconds %q", value)
+		}
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(fraction*1e9)), nil
+	case LayoutEpochMilli:
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(millis), nil
+	case LayoutISOWeek:
+		return p.parseISOWeek(value)
+	default:
+		return time.ParseInLocation(layout, value, p.location)
+	}
+}
+
+// parseISOWeek parses an ISO 8601 week date with an optional time of day
+func (p *TimestampParser) parseISOWeek(value string) (time.Time, error) {
+	date, clock, hasClock := strings.Cut(value, "T")
+	match := isoWeekDate.FindStringSubmatch(date)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("invalid ISO week date %q", value)
+	}
+	year, _ := strconv.Atoi(match[1])
+	week, _ := strconv.Atoi(match[2])
+	weekday, _ := strconv.Atoi(match[3])
+
+	// Week 1 is the week with the first Thursday of the year, so it holds January 4
+	if _, lastWeek := time.Date(year, 12, 28, 0, 0, 0, 0, time.UTC).ISOWeek(); week < 1 || week > lastWeek {
+		return time.Time{}, fmt.Errorf("year %d has no week %d", year, week)
+	}
+	jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7)
+	day := monday.AddDate(0, 0, (week-1)*7+weekday-1)
+
+	if !hasClock {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, p.location), nil
+	}
+	for _, layout := range []string{"15:04:05Z07:00", "15:04:05", "15:04"} {
+		t, err := time.ParseInLocation(layout, clock, p.location)
+		if err == nil {
+			return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location()), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid ISO week time %q", value)
+}
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampParser(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	parser := NewTimestampParser(TimestampOptions{
+		Layouts:  []string{LayoutRFC3339, LayoutEpochSecond, LayoutEpochMilli, LayoutDateTime, LayoutISOWeek, "02/01/2006"},
+		Location: berlin,
+	})
+
+	tests := map[string]time.Time{
+		"2025-02-09T15:04:05Z":        time.Date(2025, 2, 9, 15, 4, 5, 0, time.UTC),
+		"2025-02-09T15:04:05.5+01:00": time.Date(2025, 2, 9, 14, 4, 5, 5e8, time.UTC),
+		"1739113445":                  time.Date(2025, 2, 9, 15, 4, 5, 0, time.UTC),
+		"1739113445000":               time.Date(2025, 2, 9, 15, 4, 5, 0, time.UTC),
+		"1739113445123":               time.Date(2025, 2, 9, 15, 4, 5, 123e6, time.UTC),
+		// Zone-less values are in the default timezone
+		"2025-02-09 16:04:05": time.Date(2025, 2, 9, 15, 4, 5, 0, time.UTC),
+		"09/02/2025":          time.Date(2025, 2, 8, 23, 0, 0, 0, time.UTC),
+		// 2025-W06-7 is Sunday 9 February 2025
+		"2025-W06-7":         time.Date(2025, 2, 8, 23, 0, 0, 0, time.UTC),
+		"2025W067T15:04:05Z": time.Date(2025, 2, 9, 15, 4, 5, 0, time.UTC),
+		"2020-W53-5T12:00":   time.Date(2021, 1, 1, 11, 0, 0, 0, time.UTC),
+	}
+	for value, expected := range tests {
+		parsed, err := parser.Parse(value)
+		assert.NoError(t, err, value)
+		assert.True(t, expected.Equal(parsed), "%s: expected %s, got %s", value, expected, parsed)
+		assert.Equal(t, time.UTC, parsed.Location(), value)
+	}
+
+	for _, value := range []string{"", "yesterday", "2025-W54-1", "2025-W06-8", "2025-02-30 10:00:00"} {
+		_, err := parser.Parse(value)
+		assert.Error(t, err, value)
+		assert.Equal(t, ReasonBadTimestamp, err.(*RecordError).Reason, value)
+	}
+}
+
+func TestTimestampParser_Default(t *testing.T) {
+	_, err := defaultTimestamps.Parse("2025-02-09T15:04:05Z")
+	assert.NoError(t, err)
+	_, err = defaultTimestamps.Parse("1739113445")
+	assert.Error(t, err)
+}
+
+func TestTimestampParser_MaxFuture(t *testing.T) {
+	parser := NewTimestampParser(TimestampOptions{MaxFuture: time.Hour})
+	parser.now = func() time.Time { return time.Date(2025, 2, 9, 12, 0, 0, 0, time.UTC) }
+
+	_, err := parser.Parse("2025-02-09T12:59:00Z")
+	assert.NoError(t, err)
+
+	_, err = parser.Parse("2025-02-09T13:01:00Z")
+	assert.Error(t, err)
+	assert.Equal(t, ReasonFutureTimestamp, err.(*RecordError).Reason)
+}
+
+func TestParseTimestampLayouts(t *testing.T) {
+	assert.Equal(t, []string{"rfc3339", "epoch_ms", "2006-01-02 15:04:05"}, ParseTimestampLayouts(" rfc3339; epoch_ms;;2006-01-02 15:04:05 "))
+	assert.Empty(t, ParseTimestampLayouts(""))
+}
+
+func TestParseRecord_TimestampLayouts(t *testing.T) {
+	parser := NewTimestampParser(TimestampOptions{Layouts: []string{LayoutEpochMilli}})
+
+	event, err := parseRecord([]string{"1", testFootprint, "1739113445123"}, parser, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2025, 2, 9, 15, 4, 5, 123e6, time.UTC), event.Timestamp)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/radu2020/planet/internal/storage"
+)
+
+// ValidationError is returned when a request parameter is invalid
+type ValidationError struct {
+	Param   string `json:"param"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid parameter %q: %s", e.Param, e.Message)
+}
+
+// ParseCollectionFilter reads the org_id, from and to query parameters into a
+// storage.CollectionFilter. Timestamps are accepted as RFC3339 or as plain dates.
+func ParseCollectionFilter(query url.Values) (storage.CollectionFilter, error) {
+	var filter storage.CollectionFilter
+
+	if value := query.Get("org_id"); value != "" {
+		orgID, err := strconv.Atoi(value)
+		if err != nil || orgID < 0 {
+			return filter, &ValidationError{Param: "org_id", Message: "must be a non-negative integer"}
+		}
+		filter.OrgID = &orgID
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(query, "to"); err != nil {
+		return filter, err
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, &ValidationError{Param: "to", Message: "must be after from"}
+	}
+
+	if value := query.Get("bbox"); value != "" {
+		bbox, err := parseBBox(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.BBox = bbox
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam parses an optional timestamp query parameter
+func parseTimeParam(query url.Values, param string) (time.Time, error) {
+	value := query.Get(param)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &ValidationError{Param: param, Message: "must be an RFC3339 timestamp or a YYYY-MM-DD date"}
+}
+
+// parseBBox parses a minLon,minLat,maxLon,maxLat bounding box in WGS84
+func parseBBox(value string) (*orb.Bound, error) {
+	invalid := &ValidationError{Param: "bbox", Message: "must be minLon,minLat,maxLon,maxLat in WGS84"}
+
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, invalid
+	}
+
+	var coords [4]float64
+	for i, part := range parts {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, invalid
+		}
+		coords[i] = coord
+	}
+
+	bound := orb.Bound{Min: orb.Point{coords[0], coords[1]}, Max: orb.Point{coords[2], coords[3]}}
+	if bound.Min.Lon() < -180 || bound.Max.Lon() > 180 || bound.Min.Lat() < -90 || bound.Max.Lat() > 90 {
+		return nil, invalid
+	}
+	if bound.Min.Lon() > bound.Max.Lon() || bound.Min.Lat() > bound.Max.Lat() {
+		return nil, invalid
+	}
+	return &bound, nil
+}
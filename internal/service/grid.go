@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	"github.com/radu2020/planet/internal/storage"
+)
+
+const (
+	DefaultCellSize = 0.01
+	MinCellSize     = 0.0001
+	MaxCellSize     = 10.0
+)
+
+// gridCell is the index of a cell in the lon/lat grid
+type gridCell struct {
+	x, y int64
+}
+
+// gridStats holds the aggregated values of a grid cell
+type gridStats struct {
+	count int
+	area  float64
+}
+
+// ParseCellSize reads the cell query parameter, the size of a grid cell in degrees
+func ParseCellSize(query url.Values) (float64, error) {
+	value := query.Get("cell")
+	if value == "" {
+		return DefaultCellSize, nil
+	}
+
+	cell, err := strconv.ParseFloat(value, 64)
+	if err != nil || cell < MinCellSize || cell > MaxCellSize {
+		return 0, &ValidationError{Param: "cell", Message: "must be a number of degrees between 0.0001 and 10"}
+	}
+	return cell, nil
+}
+
+// Aggregate the features matching the filter into a regular lon/lat grid.
+// Each footprint is counted in the cell holding its centroid. Every non empty
+// cell is returned as a polygon with the count and the summed geodesic area
+// of its footprints.
+func (s DataService) GetGrid(ctx context.Context, filter storage.CollectionFilter, cellSize float64) (*geojson.FeatureCollection, error) {
+	cells := make(map[gridCell]*gridStats)
+
+	err := s.storage.StreamCollection(ctx, filter, func(f *geojson.Feature) error {
+		if f.Geometry == nil {
+			return nil
+		}
+		centroid, _ := planar.CentroidArea(f.Geometry)
+		cell := gridCell{
+			x: int64(math.Floor(centroid.Lon() / cellSize)),
+			y: int64(math.Floor(centroid.Lat() / cellSize)),
+		}
+
+		stats, ok := cells[cell]
+		if !ok {
+			stats = &gridStats{}
+			cells[cell] = stats
+		}
+		stats.count++
+		stats.area += geo.Area(f.Geometry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort the cells so the response is stable
+	keys := make([]gridCell, 0, len(cells))
+	for cell := range cells {
+		keys = append(keys, cell)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].y != keys[j].y {
+			return keys[i].y < keys[j].y
+		}
+		return keys[i].x < keys[j].x
+	})
+
+	fc := geojson.NewFeatureCollection()
+	for _, cell := range keys {
+		bound := orb.Bound{
+			Min: orb.Point{float64(cell.x) * cellSize, float64(cell.y) * cellSize},
+			Max: orb.Point{float64(cell.x+1) * cellSize, float64(cell.y+1) * cellSize},
+		}
+		f := geojson.NewFeature(bound.ToPolygon())
+		f.Properties["count"] = cells[cell].count
+		f.Properties["area_m2"] = cells[cell].area
+		fc.Append(f)
+	}
+
+	return fc, nil
+}
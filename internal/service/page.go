@@ -0,0 +1,80 @@
+package service
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/radu2020/planet/internal/storage"
+)
+
+const (
+	DefaultPageSize = 1000
+	MaxPageSize     = 10000
+)
+
+// IsPaged reports whether the query asks for a page of the collection
+func IsPaged(query url.Values) bool {
+	return query.Has("limit") || query.Has("cursor")
+}
+
+// ParsePageRequest reads the limit and cursor query parameters. A missing limit
+// is left at zero so the service can apply the default page size.
+func ParsePageRequest(query url.Values) (storage.PageRequest, error) {
+	var page storage.PageRequest
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return page, &ValidationError{Param: "limit", Message: "must be a positive integer"}
+		}
+		page.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := DecodeCursor(value)
+		if err != nil {
+			return page, &ValidationError{Param: "cursor", Message: "is not a valid cursor"}
+		}
+		page.After = cursor
+	}
+
+	return page, nil
+}
+
+// EncodeCursor turns a cursor into an opaque URL safe token
+func EncodeCursor(cursor *storage.Cursor) string {
+	raw := cursor.Timestamp.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(cursor.OrgID) + "|" + cursor.FootprintMD5
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a token created by EncodeCursor
+func DecodeCursor(token string) (*storage.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return nil, strconv.ErrSyntax
+	}
+	timestamp, orgID, footprintMD5 := parts[0], parts[1], parts[2]
+
+	var cursor storage.Cursor
+	if cursor.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+		return nil, err
+	}
+	if cursor.OrgID, err = strconv.Atoi(orgID); err != nil {
+		return nil, err
+	}
+	if sum, err := hex.DecodeString(footprintMD5); err != nil || len(sum) != md5.Size {
+		return nil, strconv.ErrSyntax
+	}
+	cursor.FootprintMD5 = footprintMD5
+	return &cursor, nil
+}
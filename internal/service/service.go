@@ -1,10 +1,18 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/paulmach/orb/geojson"
 	"github.com/radu2020/planet/internal/storage"
+	"io"
 )
 
+// ErrStreamInterrupted is returned when streaming fails after part of the
+// response has already been written
+var ErrStreamInterrupted = errors.New("stream interrupted")
+
 type DataService struct {
 	storage storage.Storage
 }
@@ -13,21 +21,48 @@ func NewDataService(storage storage.Storage) *DataService {
 	return &DataService{storage: storage}
 }
 
-// Get all features from the database and return geojson FeatureCollection
-func (s DataService) GetCollection() (*geojson.FeatureCollection, error) {
-	fc, err := s.storage.GetCollection()
+// Get a page of the features matching the filter. The page size defaults to
+// DefaultPageSize and is capped at MaxPageSize. The returned token is empty
+// when there are no more pages.
+func (s DataService) GetCollectionPage(ctx context.Context, filter storage.CollectionFilter, page storage.PageRequest) (*geojson.FeatureCollection, string, error) {
+	if page.Limit <= 0 {
+		page.Limit = DefaultPageSize
+	}
+	if page.Limit > MaxPageSize {
+		page.Limit = MaxPageSize
+	}
+
+	fc, next, err := s.storage.GetCollectionPage(ctx, filter, page)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	if next == nil {
+		return fc, "", nil
+	}
+	return fc, EncodeCursor(next), nil
+}
+
+// Stream the features matching the filter to w as a geojson FeatureCollection
+// while they are read from the database
+func (s DataService) StreamCollection(ctx context.Context, w io.Writer, filter storage.CollectionFilter) error {
+	fw := newFeatureCollectionWriter(w)
+
+	err := s.storage.StreamCollection(ctx, filter, fw.WriteFeature)
+	if err == nil {
+		err = fw.Close()
+	}
+	if err != nil && fw.Started() {
+		return fmt.Errorf("%w: %v", ErrStreamInterrupted, err)
 	}
-	return fc, nil
+	return err
 }
 
 type OrgIDList struct {
 	OrgIDs []int `json:"org_ids"`
 }
 
-func (s DataService) GetOrgIDs() (*OrgIDList, error) {
-	orgIDs, err := s.storage.GetOrgIDs()
+func (s DataService) GetOrgIDs(ctx context.Context) (*OrgIDList, error) {
+	orgIDs, err := s.storage.GetOrgIDs(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1,11 +1,20 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
 	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/radu2020/planet/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"net/url"
 	"testing"
+	"time"
 )
 
 // Mock Storage
@@ -13,60 +22,482 @@ type MockStorage struct {
 	mock.Mock
 }
 
-func (m *MockStorage) GetCollection() (*geojson.FeatureCollection, error) {
-	args := m.Called()
-	return args.Get(0).(*geojson.FeatureCollection), args.Error(1)
+func (m *MockStorage) GetCollectionPage(ctx context.Context, filter storage.CollectionFilter, page storage.PageRequest) (*geojson.FeatureCollection, *storage.Cursor, error) {
+	args := m.Called(filter, page)
+	return args.Get(0).(*geojson.FeatureCollection), args.Get(1).(*storage.Cursor), args.Error(2)
+}
+
+func (m *MockStorage) StreamCollection(ctx context.Context, filter storage.CollectionFilter, fn func(*geojson.Feature) error) error {
+	args := m.Called(filter, fn)
+	return args.Error(0)
 }
 
-func (m *MockStorage) GetOrgIDs() ([]int, error) {
+func (m *MockStorage) GetOrgIDs(ctx context.Context) ([]int, error) {
 	args := m.Called()
 	return args.Get(0).([]int), args.Error(1)
 }
 
-func TestGetCollection_Success(t *testing.T) {
+func (m *MockStorage) GetUsageSummary(ctx context.Context, filter storage.CollectionFilter) (storage.UsageSummary, error) {
+	args := m.Called(filter)
+	return args.Get(0).(storage.UsageSummary), args.Error(1)
+}
+
+func (m *MockStorage) GetDailyUsage(ctx context.Context, filter storage.CollectionFilter) ([]storage.DailyUsage, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]storage.DailyUsage), args.Error(1)
+}
+
+func TestStreamCollection_Success(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("StreamCollection", storage.CollectionFilter{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(1).(func(*geojson.Feature) error)
+			for i := 0; i < 250; i++ {
+				_ = fn(geojson.NewFeature(orb.Point{float64(i), 0}))
+			}
+		}).
+		Return(nil)
+
+	service := NewDataService(mockStorage)
+	var buf bytes.Buffer
+	err := service.StreamCollection(context.Background(), &buf, storage.CollectionFilter{})
+	assert.NoError(t, err)
+
+	fc, err := geojson.UnmarshalFeatureCollection(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Len(t, fc.Features, 250)
+	assert.Equal(t, orb.Point{249, 0}, fc.Features[249].Geometry)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestStreamCollection_Empty(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("StreamCollection", storage.CollectionFilter{}, mock.Anything).Return(nil)
+
+	service := NewDataService(mockStorage)
+	var buf bytes.Buffer
+	err := service.StreamCollection(context.Background(), &buf, storage.CollectionFilter{})
+
+	assert.NoError(t, err)
+	assert.True(t, json.Valid(buf.Bytes()))
+	assert.JSONEq(t, `{"type":"FeatureCollection","features":[]}`, buf.String())
+}
+
+func TestStreamCollection_QueryError(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("StreamCollection", storage.CollectionFilter{}, mock.Anything).Return(errors.New("database error"))
+
+	service := NewDataService(mockStorage)
+	var buf bytes.Buffer
+	err := service.StreamCollection(context.Background(), &buf, storage.CollectionFilter{})
+
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrStreamInterrupted))
+	assert.Empty(t, buf.String())
+}
+
+func TestStreamCollection_Interrupted(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("StreamCollection", storage.CollectionFilter{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(1).(func(*geojson.Feature) error)
+			_ = fn(geojson.NewFeature(orb.Point{1, 2}))
+		}).
+		Return(errors.New("connection reset"))
+
+	service := NewDataService(mockStorage)
+	var buf bytes.Buffer
+	err := service.StreamCollection(context.Background(), &buf, storage.CollectionFilter{})
+
+	assert.True(t, errors.Is(err, ErrStreamInterrupted))
+}
+
+func TestGetCollectionPage_DefaultLimit(t *testing.T) {
 	mockStorage := new(MockStorage)
 	expectedFC := geojson.NewFeatureCollection()
-	mockStorage.On("GetCollection").Return(expectedFC, nil)
+	mockStorage.On("GetCollectionPage", storage.CollectionFilter{}, storage.PageRequest{Limit: DefaultPageSize}).
+		Return(expectedFC, (*storage.Cursor)(nil), nil)
 
 	service := NewDataService(mockStorage)
-	fc, err := service.GetCollection()
+	fc, next, err := service.GetCollectionPage(context.Background(), storage.CollectionFilter{}, storage.PageRequest{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedFC, fc)
+	assert.Empty(t, next)
 	mockStorage.AssertExpectations(t)
 }
 
-func TestGetCollection_Error(t *testing.T) {
+func TestGetCollectionPage_MemoryStorage(t *testing.T) {
+	memory := storage.NewMemoryStorage()
+	var events []storage.UsageEvent
+	for i := 0; i < 5; i++ {
+		footprint := geojson.NewFeature(orb.Polygon{{{13, 52}, {14, 52}, {14, 53}, {13, 52}}})
+		footprint.Properties["n"] = i
+		events = append(events, storage.UsageEvent{OrgID: int64(i % 2), Footprint: footprint, Timestamp: time.Date(2025, 2, 9, i, 0, 0, 0, time.UTC)})
+	}
+	_, err := memory.WriteEvents(context.Background(), events)
+	assert.NoError(t, err)
+
+	// Follow the cursor tokens through all pages
+	service := NewDataService(memory)
+	var seen []interface{}
+	page := storage.PageRequest{Limit: 2}
+	for {
+		fc, next, err := service.GetCollectionPage(context.Background(), storage.CollectionFilter{}, page)
+		assert.NoError(t, err)
+		for _, f := range fc.Features {
+			seen = append(seen, f.Properties["n"])
+		}
+		if next == "" {
+			break
+		}
+		page.After, err = DecodeCursor(next)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []interface{}{0.0, 1.0, 2.0, 3.0, 4.0}, seen)
+}
+
+func TestGetCollectionPage_MaxLimit(t *testing.T) {
+	cursor := &storage.Cursor{Timestamp: time.Date(2024, 7, 1, 4, 0, 28, 8000000, time.UTC), OrgID: 6, FootprintMD5: "0cc175b9c0f1b6a831c399e269772661"}
+
 	mockStorage := new(MockStorage)
-	mockStorage.On("GetCollection").Return((*geojson.FeatureCollection)(nil), errors.New("database error"))
+	mockStorage.On("GetCollectionPage", storage.CollectionFilter{}, storage.PageRequest{Limit: MaxPageSize}).
+		Return(geojson.NewFeatureCollection(), cursor, nil)
 
 	service := NewDataService(mockStorage)
-	fc, err := service.GetCollection()
+	_, next, err := service.GetCollectionPage(context.Background(), storage.CollectionFilter{}, storage.PageRequest{Limit: MaxPageSize + 1})
+
+	assert.NoError(t, err)
+	decoded, err := DecodeCursor(next)
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGetCollectionPage_Error(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("GetCollectionPage", storage.CollectionFilter{}, storage.PageRequest{Limit: 10}).
+		Return((*geojson.FeatureCollection)(nil), (*storage.Cursor)(nil), errors.New("database error"))
+
+	service := NewDataService(mockStorage)
+	fc, next, err := service.GetCollectionPage(context.Background(), storage.CollectionFilter{}, storage.PageRequest{Limit: 10})
 
 	assert.Error(t, err)
 	assert.Nil(t, fc)
+	assert.Empty(t, next)
+}
+
+func TestParsePageRequest(t *testing.T) {
+	cursor := &storage.Cursor{Timestamp: time.Date(2024, 7, 1, 4, 1, 21, 0, time.UTC), OrgID: 33, FootprintMD5: "92eb5ffee6ae2fec3ad71c777531578f"}
+	query := url.Values{"limit": {"50"}, "cursor": {EncodeCursor(cursor)}}
+
+	page, err := ParsePageRequest(query)
+
+	assert.NoError(t, err)
+	assert.Equal(t, storage.PageRequest{Limit: 50, After: cursor}, page)
+	assert.True(t, IsPaged(query))
+	assert.False(t, IsPaged(url.Values{"org_id": {"1"}}))
+}
+
+func TestParsePageRequest_Invalid(t *testing.T) {
+	tests := []struct {
+		query url.Values
+		param string
+	}{
+		{url.Values{"limit": {"0"}}, "limit"},
+		{url.Values{"limit": {"ten"}}, "limit"},
+		{url.Values{"cursor": {"!!!"}}, "cursor"},
+		{url.Values{"cursor": {"bm90LWEtY3Vyc29y"}}, "cursor"},
+		{url.Values{"cursor": {EncodeCursor(&storage.Cursor{Timestamp: time.Now(), OrgID: 1, FootprintMD5: "abc"})}}, "cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query.Encode(), func(t *testing.T) {
+			_, err := ParsePageRequest(tt.query)
+
+			var validationErr *ValidationError
+			assert.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, tt.param, validationErr.Param)
+		})
+	}
+}
+
+func TestGetTile(t *testing.T) {
+	orgID := 6
+	tile := maptile.At(orb.Point{13.3484, 52.4551}, 14)
+	polygon := orb.Polygon{{
+		{13.3462457, 52.4540429}, {13.3484613, 52.455192}, {13.3466075, 52.4589409}, {13.3462457, 52.4540429},
+	}}
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("StreamCollection", mock.MatchedBy(func(filter storage.CollectionFilter) bool {
+		return *filter.OrgID == orgID && filter.BBox.Contains(tile.Center())
+	}), mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(1).(func(*geojson.Feature) error)
+			_ = fn(geojson.NewFeature(polygon))
+		}).
+		Return(nil)
+
+	service := NewDataService(mockStorage)
+	payload, err := service.GetTile(context.Background(), tile, &orgID)
+	assert.NoError(t, err)
+
+	layers, err := mvt.Unmarshal(payload)
+	assert.NoError(t, err)
+	assert.Len(t, layers, 1)
+	assert.Equal(t, TileLayer, layers[0].Name)
+	assert.Len(t, layers[0].Features, 1)
 	mockStorage.AssertExpectations(t)
 }
 
+func TestGetTile_Empty(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("StreamCollection", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewDataService(mockStorage)
+	payload, err := service.GetTile(context.Background(), maptile.New(0, 0, 0), nil)
+
+	assert.NoError(t, err)
+	assert.Empty(t, payload)
+}
+
+func TestParseTile(t *testing.T) {
+	tile, err := ParseTile("14", "8802", "5373.mvt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, maptile.New(8802, 5373, 14), tile)
+}
+
+func TestParseTile_Invalid(t *testing.T) {
+	tests := []struct {
+		z, x, y string
+		param   string
+	}{
+		{"23", "0", "0.mvt", "z"},
+		{"a", "0", "0.mvt", "z"},
+		{"1", "-1", "0.mvt", "x"},
+		{"1", "0", "0.png", "y"},
+		{"1", "0", "b.mvt", "y"},
+		{"1", "2", "0.mvt", "x"},
+		{"1", "0", "2.mvt", "y"},
+		{"0", "0", "1.mvt", "y"},
+		{"22", "4194304", "0.mvt", "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.z+"/"+tt.x+"/"+tt.y, func(t *testing.T) {
+			_, err := ParseTile(tt.z, tt.x, tt.y)
+
+			var validationErr *ValidationError
+			assert.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, tt.param, validationErr.Param)
+		})
+	}
+}
+
+func TestGetGrid(t *testing.T) {
+	square := func(lon, lat float64) *geojson.Feature {
+		return geojson.NewFeature(orb.Polygon{{
+			{lon, lat}, {lon + 0.001, lat}, {lon + 0.001, lat + 0.001}, {lon, lat + 0.001}, {lon, lat},
+		}})
+	}
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("StreamCollection", storage.CollectionFilter{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(1).(func(*geojson.Feature) error)
+			_ = fn(square(13.341, 52.451))
+			_ = fn(square(13.345, 52.455))
+			_ = fn(square(13.361, 52.451))
+			_ = fn(geojson.NewFeature(nil))
+		}).
+		Return(nil)
+
+	service := NewDataService(mockStorage)
+	grid, err := service.GetGrid(context.Background(), storage.CollectionFilter{}, 0.01)
+
+	assert.NoError(t, err)
+	assert.Len(t, grid.Features, 2)
+
+	first := grid.Features[0]
+	assert.Equal(t, 2, first.Properties["count"])
+	assert.InDelta(t, 13.34, first.Geometry.Bound().Min.Lon(), 1e-9)
+	assert.InDelta(t, 52.45, first.Geometry.Bound().Min.Lat(), 1e-9)
+	// A 0.001 degree square at this latitude is roughly 68m x 111m
+	assert.InDelta(t, 2*7550.0, first.Properties["area_m2"].(float64), 200)
+
+	assert.Equal(t, 1, grid.Features[1].Properties["count"])
+	mockStorage.AssertExpectations(t)
+}
+
+func TestParseCellSize(t *testing.T) {
+	cell, err := ParseCellSize(url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultCellSize, cell)
+
+	cell, err = ParseCellSize(url.Values{"cell": {"0.5"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, cell)
+
+	for _, value := range []string{"0", "-1", "20", "big"} {
+		_, err := ParseCellSize(url.Values{"cell": {value}})
+		assert.Error(t, err)
+	}
+}
+
+func TestGetOrgUsage(t *testing.T) {
+	orgID := 6
+	filter := storage.CollectionFilter{OrgID: &orgID}
+	first := time.Date(2024, 7, 1, 4, 0, 28, 0, time.UTC)
+	last := time.Date(2024, 7, 2, 9, 30, 0, 0, time.UTC)
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("GetUsageSummary", filter).Return(storage.UsageSummary{Count: 3, First: first, Last: last}, nil)
+	mockStorage.On("GetDailyUsage", filter).Return([]storage.DailyUsage{
+		{Day: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), Count: 2},
+		{Day: time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC), Count: 1},
+	}, nil)
+	mockStorage.On("StreamCollection", filter, mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(1).(func(*geojson.Feature) error)
+			// Roughly 1.11km x 1.11km at the equator
+			_ = fn(geojson.NewFeature(orb.Polygon{{{0, 0}, {0.01, 0}, {0.01, 0.01}, {0, 0.01}, {0, 0}}}))
+			_ = fn(geojson.NewFeature(orb.Polygon{{{0, 0}, {0.01, 0}, {0.01, 0.01}, {0, 0.01}, {0, 0}}}))
+		}).
+		Return(nil)
+
+	service := NewDataService(mockStorage)
+	usage, err := service.GetOrgUsage(context.Background(), orgID, time.Time{}, time.Time{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 6, usage.OrgID)
+	assert.Equal(t, 3, usage.FootprintCount)
+	assert.InDelta(t, 2*1.2364, usage.AreaKm2, 0.01)
+	assert.Equal(t, first, usage.FirstEvent)
+	assert.Equal(t, last, usage.LastEvent)
+	assert.Equal(t, []DailyUsage{{Date: "2024-07-01", Count: 2}, {Date: "2024-07-02", Count: 1}}, usage.Daily)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGetOrgUsage_NoUsage(t *testing.T) {
+	orgID := 99
+	mockStorage := new(MockStorage)
+	mockStorage.On("GetUsageSummary", storage.CollectionFilter{OrgID: &orgID}).Return(storage.UsageSummary{}, nil)
+
+	service := NewDataService(mockStorage)
+	usage, err := service.GetOrgUsage(context.Background(), orgID, time.Time{}, time.Time{})
+
+	assert.True(t, errors.Is(err, ErrNoUsage))
+	assert.Nil(t, usage)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGetOrgUsage_Error(t *testing.T) {
+	orgID := 6
+	mockStorage := new(MockStorage)
+	mockStorage.On("GetUsageSummary", storage.CollectionFilter{OrgID: &orgID}).Return(storage.UsageSummary{}, errors.New("database error"))
+
+	service := NewDataService(mockStorage)
+	usage, err := service.GetOrgUsage(context.Background(), orgID, time.Time{}, time.Time{})
+
+	assert.Error(t, err)
+	assert.Nil(t, usage)
+}
+
+func TestParseOrgID(t *testing.T) {
+	orgID, err := ParseOrgID("42")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, orgID)
+
+	_, err = ParseOrgID("abc")
+	assert.Error(t, err)
+}
+
+func TestParseCollectionFilter(t *testing.T) {
+	query := url.Values{}
+	query.Set("org_id", "6")
+	query.Set("from", "2024-07-01")
+	query.Set("to", "2024-07-01T12:00:00Z")
+
+	filter, err := ParseCollectionFilter(query)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 6, *filter.OrgID)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), filter.From)
+	assert.Equal(t, time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC), filter.To)
+}
+
+func TestParseCollectionFilter_BBox(t *testing.T) {
+	filter, err := ParseCollectionFilter(url.Values{"bbox": {"13.3,52.4,13.4,52.5"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &orb.Bound{Min: orb.Point{13.3, 52.4}, Max: orb.Point{13.4, 52.5}}, filter.BBox)
+}
+
+func TestParseCollectionFilter_Empty(t *testing.T) {
+	filter, err := ParseCollectionFilter(url.Values{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, storage.CollectionFilter{}, filter)
+}
+
+func TestParseCollectionFilter_Invalid(t *testing.T) {
+	tests := []struct {
+		query url.Values
+		param string
+	}{
+		{url.Values{"org_id": {"abc"}}, "org_id"},
+		{url.Values{"org_id": {"-1"}}, "org_id"},
+		{url.Values{"from": {"yesterday"}}, "from"},
+		{url.Values{"to": {"2024-13-01"}}, "to"},
+		{url.Values{"from": {"2024-07-02"}, "to": {"2024-07-01"}}, "to"},
+		{url.Values{"bbox": {"13.3,52.4,13.4"}}, "bbox"},
+		{url.Values{"bbox": {"13.3,52.4,east,52.5"}}, "bbox"},
+		{url.Values{"bbox": {"13.4,52.4,13.3,52.5"}}, "bbox"},
+		{url.Values{"bbox": {"-181,52.4,13.3,52.5"}}, "bbox"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query.Encode(), func(t *testing.T) {
+			_, err := ParseCollectionFilter(tt.query)
+
+			var validationErr *ValidationError
+			assert.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, tt.param, validationErr.Param)
+		})
+	}
+}
+
 func TestGetOrgIDs_Success(t *testing.T) {
 	mockStorage := new(MockStorage)
 	expectedIDs := []int{1, 2, 3}
 	mockStorage.On("GetOrgIDs").Return(expectedIDs, nil)
 
 	service := NewDataService(mockStorage)
-	result, err := service.GetOrgIDs()
+	result, err := service.GetOrgIDs(context.Background())
 
 	assert.NoError(t, err)
 	assert.Equal(t, &OrgIDList{OrgIDs: expectedIDs}, result)
 	mockStorage.AssertExpectations(t)
 }
 
+func TestGetOrgIDs_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service := NewDataService(storage.NewMemoryStorage())
+
+	result, err := service.GetOrgIDs(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Nil(t, result)
+}
+
 func TestGetOrgIDs_Error(t *testing.T) {
 	mockStorage := new(MockStorage)
 	mockStorage.On("GetOrgIDs").Return([]int(nil), errors.New("database error"))
 
 	service := NewDataService(mockStorage)
-	result, err := service.GetOrgIDs()
+	result, err := service.GetOrgIDs(context.Background())
 
 	assert.Error(t, err)
 	assert.Nil(t, result)
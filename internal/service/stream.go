@@ -0,0 +1,85 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// flushInterval is the number of features written between two flushes
+const flushInterval = 100
+
+// featureCollectionWriter encodes a GeoJSON FeatureCollection one feature at a
+// time, so the full collection never has to be held in memory
+type featureCollectionWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	count   int
+	started bool
+}
+
+func newFeatureCollectionWriter(w io.Writer) *featureCollectionWriter {
+	flusher, _ := w.(http.Flusher)
+	return &featureCollectionWriter{w: w, flusher: flusher}
+}
+
+// WriteFeature appends a feature to the collection, writing the envelope first
+// if this is the first feature
+func (fw *featureCollectionWriter) WriteFeature(f *geojson.Feature) error {
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	if err := fw.open(); err != nil {
+		return err
+	}
+	if fw.count > 0 {
+		if _, err := io.WriteString(fw.w, ","); err != nil {
+			return err
+		}
+	}
+	if _, err := fw.w.Write(payload); err != nil {
+		return err
+	}
+
+	fw.count++
+	if fw.count%flushInterval == 0 {
+		fw.flush()
+	}
+	return nil
+}
+
+// Close terminates the features array and the collection object
+func (fw *featureCollectionWriter) Close() error {
+	if err := fw.open(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw.w, "]}"); err != nil {
+		return err
+	}
+	fw.flush()
+	return nil
+}
+
+// Started reports whether anything has been written to the underlying writer
+func (fw *featureCollectionWriter) Started() bool {
+	return fw.started
+}
+
+func (fw *featureCollectionWriter) open() error {
+	if fw.started {
+		return nil
+	}
+	fw.started = true
+	_, err := io.WriteString(fw.w, `{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+func (fw *featureCollectionWriter) flush() {
+	if fw.flusher != nil {
+		fw.flusher.Flush()
+	}
+}
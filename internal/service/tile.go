@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/simplify"
+	"github.com/radu2020/planet/internal/storage"
+)
+
+const (
+	// TileLayer is the name of the vector tile layer holding the footprints
+	TileLayer = "footprints"
+
+	// MaxTileZoom is the highest zoom level tiles are served for
+	MaxTileZoom = 22
+
+	// tileBuffer is the buffer around a tile, in tile extent units, that is kept
+	// when clipping so polygons do not show seams at tile edges
+	tileBuffer = 64
+
+	// tileSimplifyThreshold is the Douglas-Peucker threshold in tile extent units
+	tileSimplifyThreshold = 1.0
+)
+
+// ParseTile reads the z, x and y path values of a tile request. The y value
+// must carry the .mvt extension.
+func ParseTile(z, x, y string) (maptile.Tile, error) {
+	zoom, err := strconv.ParseUint(z, 10, 32)
+	if err != nil || zoom > MaxTileZoom {
+		return maptile.Tile{}, &ValidationError{Param: "z", Message: "must be a zoom level between 0 and " + strconv.Itoa(MaxTileZoom)}
+	}
+
+	// A zoom level has 2^z tiles along each axis
+	tiles := uint64(1) << zoom
+	outOfRange := "must be below " + strconv.FormatUint(tiles, 10) + " at zoom level " + z
+
+	tileX, err := strconv.ParseUint(x, 10, 32)
+	if err != nil {
+		return maptile.Tile{}, &ValidationError{Param: "x", Message: "must be a non-negative integer"}
+	}
+	if tileX >= tiles {
+		return maptile.Tile{}, &ValidationError{Param: "x", Message: outOfRange}
+	}
+
+	y, found := strings.CutSuffix(y, ".mvt")
+	if !found {
+		return maptile.Tile{}, &ValidationError{Param: "y", Message: "must end with .mvt"}
+	}
+	tileY, err := strconv.ParseUint(y, 10, 32)
+	if err != nil {
+		return maptile.Tile{}, &ValidationError{Param: "y", Message: "must be a non-negative integer"}
+	}
+	if tileY >= tiles {
+		return maptile.Tile{}, &ValidationError{Param: "y", Message: outOfRange}
+	}
+
+	return maptile.New(uint32(tileX), uint32(tileY), maptile.Zoom(zoom)), nil
+}
+
+// Get the footprints within the tile as an encoded Mapbox Vector Tile. The
+// geometries are clipped to the tile and simplified for its zoom level.
+// An empty slice is returned when the tile holds no footprints.
+func (s DataService) GetTile(ctx context.Context, tile maptile.Tile, orgID *int) ([]byte, error) {
+	bound := tile.Bound(float64(tileBuffer) / mvt.DefaultExtent)
+	filter := storage.CollectionFilter{OrgID: orgID, BBox: &bound}
+
+	fc := geojson.NewFeatureCollection()
+	err := s.storage.StreamCollection(ctx, filter, func(f *geojson.Feature) error {
+		fc.Append(f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	layers := mvt.NewLayers(map[string]*geojson.FeatureCollection{TileLayer: fc})
+	layers.ProjectToTile(tile)
+	layers.Clip(orb.Bound{
+		Min: orb.Point{-tileBuffer, -tileBuffer},
+		Max: orb.Point{mvt.DefaultExtent + tileBuffer, mvt.DefaultExtent + tileBuffer},
+	})
+	layers.Simplify(simplify.DouglasPeucker(tileSimplifyThreshold))
+	layers.RemoveEmpty(tileSimplifyThreshold, tileSimplifyThreshold)
+
+	if len(layers[0].Features) == 0 {
+		return []byte{}, nil
+	}
+	return mvt.Marshal(layers)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+	"github.com/radu2020/planet/internal/storage"
+)
+
+// ErrNoUsage is returned when an organization has no usage data
+var ErrNoUsage = errors.New("no usage data found")
+
+// OrgUsage holds the usage statistics of an organization
+type OrgUsage struct {
+	OrgID          int          `json:"org_id"`
+	FootprintCount int          `json:"footprint_count"`
+	AreaKm2        float64      `json:"area_km2"`
+	FirstEvent     time.Time    `json:"first_event"`
+	LastEvent      time.Time    `json:"last_event"`
+	Daily          []DailyUsage `json:"daily"`
+}
+
+// DailyUsage holds the number of footprints of a UTC day
+type DailyUsage struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// ParseOrgID reads the organization ID path value
+func ParseOrgID(value string) (int, error) {
+	orgID, err := strconv.Atoi(value)
+	if err != nil || orgID < 0 {
+		return 0, &ValidationError{Param: "id", Message: "must be a non-negative integer"}
+	}
+	return orgID, nil
+}
+
+// Get the usage statistics of an organization between from and to. Zero times
+// leave the window open. The area is the summed geodesic area of the footprints.
+func (s DataService) GetOrgUsage(ctx context.Context, orgID int, from, to time.Time) (*OrgUsage, error) {
+	filter := storage.CollectionFilter{OrgID: &orgID, From: from, To: to}
+
+	summary, err := s.storage.GetUsageSummary(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if summary.Count == 0 {
+		return nil, ErrNoUsage
+	}
+
+	days, err := s.storage.GetDailyUsage(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var area float64
+	err = s.storage.StreamCollection(ctx, filter, func(f *geojson.Feature) error {
+		if f.Geometry != nil {
+			area += geo.Area(f.Geometry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &OrgUsage{
+		OrgID:          orgID,
+		FootprintCount: summary.Count,
+		AreaKm2:        area / 1e6,
+		FirstEvent:     summary.First.UTC(),
+		LastEvent:      summary.Last.UTC(),
+		Daily:          make([]DailyUsage, 0, len(days)),
+	}
+	for _, day := range days {
+		usage.Daily = append(usage.Daily, DailyUsage{Date: day.Day.Format(time.DateOnly), Count: day.Count})
+	}
+
+	return usage, nil
+}
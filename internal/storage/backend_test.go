@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+// backend is a storage implementing both the read and the write side
+type backend interface {
+	Storage
+	Writer
+}
+
+// squareFootprint is a footprint covering the unit square at lon, lat
+func squareFootprint(lon, lat float64) string {
+	return fmt.Sprintf(`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[%g,%g],[%g,%g],[%g,%g],[%g,%g]]]},"properties":null}`,
+		lon, lat, lon+1, lat, lon+1, lat+1, lon, lat)
+}
+
+// writeTestEvents writes three events of two orgs on two days
+func writeTestEvents(t *testing.T, w Writer) {
+	events := []UsageEvent{
+		testEvent(1, squareFootprint(13, 52)),
+		testEvent(2, squareFootprint(-74, 40)),
+		testEvent(1, squareFootprint(13, 52)),
+	}
+	events[1].Timestamp = testTimestamp.Add(time.Hour)
+	events[2].Timestamp = testTimestamp.Add(24 * time.Hour)
+
+	inserted, err := w.WriteEvents(context.Background(), events)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), inserted)
+}
+
+// footprintMD5 returns the hex encoded MD5 of an encoded footprint
+func footprintMD5(footprint string) string {
+	sum := md5.Sum([]byte(footprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// streamFeatures collects the features the storage streams for the filter
+func streamFeatures(s Storage, filter CollectionFilter) ([]*geojson.Feature, error) {
+	var features []*geojson.Feature
+	err := s.StreamCollection(context.Background(), filter, func(f *geojson.Feature) error {
+		features = append(features, f)
+		return nil
+	})
+	return features, err
+}
+
+// testBackend runs the tests every backend has to pass. open returns an empty
+// backend.
+func testBackend(t *testing.T, open func(t *testing.T) backend) {
+	t.Run("WriteEvents_Duplicates", func(t *testing.T) {
+		s := open(t)
+		writeTestEvents(t, s)
+
+		inserted, err := s.WriteEvents(context.Background(), []UsageEvent{testEvent(1, squareFootprint(13, 52)), testEvent(3, emptyFeature)})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), inserted)
+
+		summary, err := s.GetUsageSummary(context.Background(), CollectionFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, 4, summary.Count)
+	})
+
+	t.Run("StreamCollection", func(t *testing.T) {
+		s := open(t)
+		writeTestEvents(t, s)
+		org := 1
+		tests := []struct {
+			name     string
+			filter   CollectionFilter
+			expected int
+		}{
+			{"all", CollectionFilter{}, 3},
+			{"org", CollectionFilter{OrgID: &org}, 2},
+			{"time", CollectionFilter{From: testTimestamp.Add(time.Minute), To: testTimestamp.Add(2 * time.Hour)}, 1},
+			{"bbox", CollectionFilter{BBox: &orb.Bound{Min: orb.Point{13.5, 52.5}, Max: orb.Point{20, 60}}}, 2},
+			{"bbox touching", CollectionFilter{BBox: &orb.Bound{Min: orb.Point{14, 53}, Max: orb.Point{20, 60}}}, 2},
+			{"bbox outside", CollectionFilter{BBox: &orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}}, 0},
+			{"org and bbox", CollectionFilter{OrgID: &org, BBox: &orb.Bound{Min: orb.Point{-80, 30}, Max: orb.Point{-70, 45}}}, 0},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				features, err := streamFeatures(s, tt.filter)
+				assert.NoError(t, err)
+				assert.Len(t, features, tt.expected)
+			})
+		}
+	})
+
+	t.Run("GetCollectionPage", func(t *testing.T) {
+		s := open(t)
+		writeTestEvents(t, s)
+
+		fc, next, err := s.GetCollectionPage(context.Background(), CollectionFilter{}, PageRequest{Limit: 2})
+		assert.NoError(t, err)
+		assert.Len(t, fc.Features, 2)
+		assert.Equal(t, &Cursor{Timestamp: testTimestamp.Add(time.Hour), OrgID: 2, FootprintMD5: footprintMD5(squareFootprint(-74, 40))}, next)
+
+		fc, next, err = s.GetCollectionPage(context.Background(), CollectionFilter{}, PageRequest{Limit: 2, After: next})
+		assert.NoError(t, err)
+		assert.Len(t, fc.Features, 1)
+		assert.Nil(t, next)
+	})
+
+	t.Run("GetCollectionPage_Ties", func(t *testing.T) {
+		s := open(t)
+
+		// Footprints of an organization sharing a timestamp fall on both
+		// sides of a page boundary
+		events := []UsageEvent{testEvent(1, squareFootprint(13, 52)), testEvent(1, squareFootprint(2, 48)), testEvent(1, squareFootprint(-74, 40))}
+		_, err := s.WriteEvents(context.Background(), events)
+		assert.NoError(t, err)
+
+		seen := make(map[string]bool)
+		page := PageRequest{Limit: 1}
+		for {
+			fc, next, err := s.GetCollectionPage(context.Background(), CollectionFilter{}, page)
+			assert.NoError(t, err)
+			for _, f := range fc.Features {
+				payload, err := f.MarshalJSON()
+				assert.NoError(t, err)
+				seen[string(payload)] = true
+			}
+			if next == nil {
+				break
+			}
+			page.After = next
+		}
+		assert.Len(t, seen, 3)
+	})
+
+	t.Run("FarYears", func(t *testing.T) {
+		s := open(t)
+
+		// Years the loader accepts beyond the range of Unix nanoseconds
+		early := time.Date(1500, 3, 1, 12, 0, 0, 0, time.UTC)
+		late := time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+		events := []UsageEvent{testEvent(1, squareFootprint(13, 52)), testEvent(2, squareFootprint(13, 52))}
+		events[0].Timestamp = early
+		events[1].Timestamp = late
+		_, err := s.WriteEvents(context.Background(), events)
+		assert.NoError(t, err)
+
+		summary, err := s.GetUsageSummary(context.Background(), CollectionFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, UsageSummary{Count: 2, First: early, Last: late}, summary)
+
+		days, err := s.GetDailyUsage(context.Background(), CollectionFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, []DailyUsage{{Day: time.Date(1500, 3, 1, 0, 0, 0, 0, time.UTC), Count: 1}, {Day: late, Count: 1}}, days)
+
+		summary, err = s.GetUsageSummary(context.Background(), CollectionFilter{From: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, summary.Count)
+
+		fc, next, err := s.GetCollectionPage(context.Background(), CollectionFilter{}, PageRequest{Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, fc.Features, 1)
+		assert.Equal(t, early, next.Timestamp)
+		fc, next, err = s.GetCollectionPage(context.Background(), CollectionFilter{}, PageRequest{Limit: 1, After: next})
+		assert.NoError(t, err)
+		assert.Len(t, fc.Features, 1)
+		assert.Nil(t, next)
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		s := open(t)
+		writeTestEvents(t, s)
+
+		orgIDs, err := s.GetOrgIDs(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, orgIDs)
+
+		org := 1
+		summary, err := s.GetUsageSummary(context.Background(), CollectionFilter{OrgID: &org})
+		assert.NoError(t, err)
+		assert.Equal(t, UsageSummary{Count: 2, First: testTimestamp, Last: testTimestamp.Add(24 * time.Hour)}, summary)
+
+		day := time.Date(2025, 2, 9, 0, 0, 0, 0, time.UTC)
+		days, err := s.GetDailyUsage(context.Background(), CollectionFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, []DailyUsage{{Day: day, Count: 2}, {Day: day.AddDate(0, 0, 1), Count: 1}}, days)
+
+		// No events match
+		org = 3
+		summary, err = s.GetUsageSummary(context.Background(), CollectionFilter{OrgID: &org})
+		assert.NoError(t, err)
+		assert.Equal(t, UsageSummary{}, summary)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		s := open(t)
+		writeTestEvents(t, s)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.GetOrgIDs(ctx)
+		assert.True(t, errors.Is(err, context.Canceled))
+		_, _, err = s.GetCollectionPage(ctx, CollectionFilter{}, PageRequest{Limit: 2})
+		assert.True(t, errors.Is(err, context.Canceled))
+		err = s.StreamCollection(ctx, CollectionFilter{}, func(f *geojson.Feature) error { return nil })
+		assert.True(t, errors.Is(err, context.Canceled))
+		_, err = s.GetUsageSummary(ctx, CollectionFilter{})
+		assert.True(t, errors.Is(err, context.Canceled))
+
+		// Nothing is written under a cancelled context
+		_, err = s.WriteEvents(ctx, []UsageEvent{testEvent(3, emptyFeature)})
+		assert.True(t, errors.Is(err, context.Canceled))
+		orgIDs, err := s.GetOrgIDs(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, orgIDs)
+	})
+}
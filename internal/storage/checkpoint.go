@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// GetCheckpoint returns the line up to which the file with the checksum was
+// loaded, or 0 when it has no checkpoint
+func GetCheckpoint(ctx context.Context, db *sql.DB, checksum string) (int, error) {
+	var line int
+	err := db.QueryRowContext(ctx, "SELECT line FROM load_checkpoints WHERE checksum = $1;", checksum).Scan(&line)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return line, err
+}
+
+// SaveCheckpoint records that the file with the checksum was loaded up to line
+func SaveCheckpoint(ctx context.Context, db *sql.DB, checksum, filePath string, line int) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO load_checkpoints (checksum, file_path, line) VALUES ($1, $2, $3)
+ON CONFLICT (checksum) DO UPDATE SET file_path = EXCLUDED.file_path, line = EXCLUDED.line, updated_at = now();`,
+		checksum, filePath, line)
+	return err
+}
+
+// DeleteCheckpoint removes the checkpoint of a file that was loaded completely
+func DeleteCheckpoint(ctx context.Context, db *sql.DB, checksum string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM load_checkpoints WHERE checksum = $1;", checksum)
+	return err
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test GetCheckpoint returns the saved line
+func TestGetCheckpoint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT line FROM load_checkpoints WHERE checksum = \$1;`).WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"line"}).AddRow(1200))
+
+	line, err := GetCheckpoint(context.Background(), db, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 1200, line)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test GetCheckpoint returns 0 for files without a checkpoint
+func TestGetCheckpoint_None(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT line FROM load_checkpoints").WithArgs("abc").WillReturnError(sql.ErrNoRows)
+
+	line, err := GetCheckpoint(context.Background(), db, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, line)
+}
+
+// Test SaveCheckpoint upserts the line
+func TestSaveCheckpoint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO load_checkpoints .* ON CONFLICT \(checksum\) DO UPDATE`).
+		WithArgs("abc", "/app/data/sample.csv", 1200).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, SaveCheckpoint(context.Background(), db, "abc", "/app/data/sample.csv", 1200))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test DeleteCheckpoint removes the checkpoint
+func TestDeleteCheckpoint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(`DELETE FROM load_checkpoints WHERE checksum = \$1;`).WithArgs("abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, DeleteCheckpoint(context.Background(), db, "abc"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
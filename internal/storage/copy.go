@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const (
+	LoadMethodInsert = "insert"
+	LoadMethodCopy   = "copy"
+)
+
+// NewBatchInserter returns the inserter for the load method. The spatial
+// variants also fill the PostGIS geometry column.
+func NewBatchInserter(method string, spatial bool) (BatchInserter, error) {
+	switch {
+	case method == LoadMethodInsert && spatial:
+		return InsertSpatialBatch, nil
+	case method == LoadMethodInsert:
+		return InsertBatch, nil
+	case method == LoadMethodCopy && spatial:
+		return CopySpatialBatch, nil
+	case method == LoadMethodCopy:
+		return CopyBatch, nil
+	}
+	return nil, fmt.Errorf("unknown load method %q", method)
+}
+
+// CopyBatch loads a batch of events with the PostgreSQL COPY protocol. It is
+// not bound by the parameter limit of InsertBatch and is faster on large batches.
+func CopyBatch(ctx context.Context, db *sql.DB, batch []UsageEvent) (int64, error) {
+	return copyBatch(ctx, db, batch, false)
+}
+
+// CopySpatialBatch works like CopyBatch and fills the PostGIS geometry column
+// from the footprint
+func CopySpatialBatch(ctx context.Context, db *sql.DB, batch []UsageEvent) (int64, error) {
+	return copyBatch(ctx, db, batch, true)
+}
+
+// copyBatch copies the events into a temporary table and moves them into the
+// data table in the same transaction, since COPY cannot skip duplicates itself
+func copyBatch(ctx context.Context, db *sql.DB, batch []UsageEvent, spatial bool) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "CREATE TEMP TABLE data_copy (LIKE data INCLUDING DEFAULTS) ON COMMIT DROP;")
+	if err != nil {
+		return 0, err
+	}
+
+	if err := copyRows(ctx, tx, "data_copy", batch, spatial); err != nil {
+		return 0, err
+	}
+
+	list := columnList(spatial)
+	result, err := tx.ExecContext(ctx, "INSERT INTO data ("+list+") SELECT "+list+" FROM data_copy"+onConflict+";")
+	if err != nil {
+		return 0, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, tx.Commit()
+}
+
+// copyRows copies the events into table within the transaction
+func copyRows(ctx context.Context, tx *sql.Tx, table string, batch []UsageEvent, spatial bool) error {
+	columns := loadColumns
+	if spatial {
+		columns = append(columns[:len(columns):len(columns)], "geom")
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+
+	for _, event := range batch {
+		args, err := eventValues(event, spatial)
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	// Flush the buffered rows
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
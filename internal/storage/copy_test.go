@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test CopyBatch copies the records and moves them into the data table
+func TestCopyBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE data_copy").WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt := mock.ExpectPrepare(`COPY "data_copy" \("org_id", "footprints_used", "source_event_timestamp"\) FROM STDIN`)
+	copyStmt.ExpectExec().WithArgs(int64(1), emptyFeature, testTimestamp).WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt.ExpectExec().WithArgs(int64(2), emptyFeature, testTimestamp).WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO data \(org_id, footprints_used, source_event_timestamp\) SELECT .* FROM data_copy ON CONFLICT`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	batch := []UsageEvent{testEvent(1, emptyFeature), testEvent(2, emptyFeature)}
+
+	inserted, err := CopyBatch(context.Background(), db, batch)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), inserted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test CopyBatch rolls back when the copy fails
+func TestCopyBatch_Error(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE data_copy").WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt := mock.ExpectPrepare("COPY")
+	copyStmt.ExpectExec().WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	batch := []UsageEvent{testEvent(1, emptyFeature)}
+
+	_, err = CopyBatch(context.Background(), db, batch)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test NewBatchInserter function
+func TestNewBatchInserter(t *testing.T) {
+	for _, method := range []string{LoadMethodInsert, LoadMethodCopy} {
+		for _, spatial := range []bool{false, true} {
+			insert, err := NewBatchInserter(method, spatial)
+			assert.NoError(t, err)
+			assert.NotNil(t, insert)
+		}
+	}
+
+	_, err := NewBatchInserter("bulk", false)
+	assert.Error(t, err)
+}
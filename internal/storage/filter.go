@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// CollectionFilter narrows down the features returned from the data table.
+// Unset fields do not restrict the result.
+type CollectionFilter struct {
+	OrgID *int
+	From  time.Time // inclusive lower bound on source_event_timestamp
+	To    time.Time // exclusive upper bound on source_event_timestamp
+	BBox  *orb.Bound
+}
+
+// Cursor is the keyset position of the last feature of a page. Events of an
+// organization may share a timestamp, so the MD5 of the footprint, which is
+// part of the unique key, breaks the tie.
+type Cursor struct {
+	Timestamp    time.Time
+	OrgID        int
+	FootprintMD5 string // hex encoded
+}
+
+// PageRequest selects a page of at most Limit features following After.
+// A nil After starts at the first feature.
+type PageRequest struct {
+	Limit int
+	After *Cursor
+}
+
+// whereClause builds the SQL WHERE clause and its arguments for the filter.
+// Placeholders are numbered starting at $1.
+func (f CollectionFilter) whereClause(postgis bool) (string, []interface{}) {
+	conditions, args := f.conditions(postgis)
+	return joinConditions(conditions), args
+}
+
+// conditions returns the SQL conditions of the filter and their arguments.
+// The bounding box is only part of the SQL when PostGIS is available.
+func (f CollectionFilter) conditions(postgis bool) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.OrgID != nil {
+		args = append(args, *f.OrgID)
+		conditions = append(conditions, fmt.Sprintf("org_id = $%d", len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From.UTC())
+		conditions = append(conditions, fmt.Sprintf("source_event_timestamp >= $%d", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To.UTC())
+		conditions = append(conditions, fmt.Sprintf("source_event_timestamp < $%d", len(args)))
+	}
+	if f.BBox != nil && postgis {
+		args = append(args, f.BBox.Min.Lon(), f.BBox.Min.Lat(), f.BBox.Max.Lon(), f.BBox.Max.Lat())
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf("ST_Intersects(geom, ST_MakeEnvelope($%d, $%d, $%d, $%d, 4326))", n-3, n-2, n-1, n))
+	}
+
+	return conditions, args
+}
+
+// matchesBound reports whether the feature's bound intersects the bounding box
+// of the filter. It is used when the database cannot filter spatially.
+func (f CollectionFilter) matchesBound(feature *geojson.Feature) bool {
+	if f.BBox == nil {
+		return true
+	}
+	if feature.Geometry == nil {
+		return false
+	}
+	return f.BBox.Intersects(feature.Geometry.Bound())
+}
+
+// joinConditions combines the conditions into a WHERE clause
+func joinConditions(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
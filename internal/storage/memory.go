@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// memoryCellSize is the size in degrees of the cells of the spatial index
+const memoryCellSize = 1.0
+
+// memoryMaxCells is the number of cells above which a footprint is kept out
+// of the spatial index and checked by every bounding box query instead
+const memoryMaxCells = 64
+
+// memoryEvent is a usage event held in memory. The footprint is kept encoded
+// and decoded on every read, since callers may modify the features they get.
+type memoryEvent struct {
+	orgID        int
+	timestamp    time.Time
+	footprint    []byte
+	footprintMD5 string     // hex encoded
+	bound        *orb.Bound // nil when the footprint has no geometry
+}
+
+// cursor returns the position of the event in the order of pages
+func (e *memoryEvent) cursor() Cursor {
+	return Cursor{Timestamp: e.timestamp, OrgID: e.orgID, FootprintMD5: e.footprintMD5}
+}
+
+// after reports whether the event follows the cursor in the order of pages,
+// by (timestamp, org_id, footprint MD5)
+func (e *memoryEvent) after(cursor Cursor) bool {
+	if !e.timestamp.Equal(cursor.Timestamp) {
+		return e.timestamp.After(cursor.Timestamp)
+	}
+	if e.orgID != cursor.OrgID {
+		return e.orgID > cursor.OrgID
+	}
+	return e.footprintMD5 > cursor.FootprintMD5
+}
+
+// memoryKey identifies an event, duplicates are skipped like in the database
+type memoryKey struct {
+	orgID     int
+	timestamp int64 // Unix microseconds, like the SQL backends keep them
+	footprint [md5.Size]byte
+}
+
+// memoryCell is a cell of the spatial index
+type memoryCell struct {
+	x, y int
+}
+
+// memoryIndex is an immutable view of the events, sorted in the order of pages
+// and indexed by organization and location. The index positions refer to the
+// sorted events and are sorted as well.
+type memoryIndex struct {
+	events []*memoryEvent
+	orgs   map[int][]int
+	cells  map[memoryCell][]int
+	large  []int // footprints spanning too many cells
+}
+
+// MemoryStorage keeps usage events in memory. It implements both the read and
+// the write side and needs no database, e.g. to serve a file for demos and
+// tests. Writes are indexed by the first read that follows them. Reads check
+// the context before they start and between streamed features.
+type MemoryStorage struct {
+	mu     sync.Mutex
+	events []*memoryEvent
+	keys   map[memoryKey]bool
+	index  *memoryIndex // nil after a write
+}
+
+// NewMemoryStorage returns an empty memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{keys: make(map[memoryKey]bool)}
+}
+
+// WriteEvents adds a batch of events and skips duplicates
+func (s *MemoryStorage) WriteEvents(ctx context.Context, batch []UsageEvent) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	events := make([]*memoryEvent, 0, len(batch))
+	keys := make([]memoryKey, 0, len(batch))
+	for _, event := range batch {
+		values, err := eventValues(event, false)
+		if err != nil {
+			return 0, err
+		}
+		footprint := []byte(values[1].(string))
+		sum := md5.Sum(footprint)
+		e := &memoryEvent{orgID: int(event.OrgID), timestamp: event.Timestamp.UTC(), footprint: footprint, footprintMD5: hex.EncodeToString(sum[:])}
+		if event.Footprint.Geometry != nil {
+			bound := event.Footprint.Geometry.Bound()
+			e.bound = &bound
+		}
+		events = append(events, e)
+		keys = append(keys, memoryKey{orgID: e.orgID, timestamp: e.timestamp.UnixMicro(), footprint: sum})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var inserted int64
+	for i, e := range events {
+		if s.keys[keys[i]] {
+			continue
+		}
+		s.keys[keys[i]] = true
+		s.events = append(s.events, e)
+		inserted++
+	}
+	if inserted > 0 {
+		s.index = nil
+	}
+	return inserted, nil
+}
+
+// snapshot returns the index of the events written so far, building it when
+// events were written since the last read
+func (s *MemoryStorage) snapshot() *memoryIndex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index != nil {
+		return s.index
+	}
+
+	events := make([]*memoryEvent, len(s.events))
+	copy(events, s.events)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[j].after(events[i].cursor())
+	})
+
+	index := &memoryIndex{events: events, orgs: make(map[int][]int), cells: make(map[memoryCell][]int)}
+	for i, e := range events {
+		index.orgs[e.orgID] = append(index.orgs[e.orgID], i)
+		if e.bound == nil {
+			continue
+		}
+		minX, minY, maxX, maxY := cellRange(*e.bound)
+		if (maxX-minX+1)*(maxY-minY+1) > memoryMaxCells {
+			index.large = append(index.large, i)
+			continue
+		}
+		for x := minX; x <= maxX; x++ {
+			for y := minY; y <= maxY; y++ {
+				cell := memoryCell{x, y}
+				index.cells[cell] = append(index.cells[cell], i)
+			}
+		}
+	}
+
+	s.index = index
+	return index
+}
+
+// cellRange returns the cells of the spatial index the bound overlaps
+func cellRange(bound orb.Bound) (minX, minY, maxX, maxY int) {
+	return int(math.Floor(bound.Min.Lon() / memoryCellSize)), int(math.Floor(bound.Min.Lat() / memoryCellSize)),
+		int(math.Floor(bound.Max.Lon() / memoryCellSize)), int(math.Floor(bound.Max.Lat() / memoryCellSize))
+}
+
+// search returns the positions of the events matching the filter that follow
+// the cursor, in order. It uses the organization index when the filter has an
+// organization, the spatial index when it has a bounding box and otherwise
+// scans the time range.
+func (idx *memoryIndex) search(filter CollectionFilter, after *Cursor) []int {
+	// The time window and the cursor narrow down the sorted events
+	start := 0
+	if !filter.From.IsZero() {
+		start = sort.Search(len(idx.events), func(i int) bool { return !idx.events[i].timestamp.Before(filter.From) })
+	}
+	if after != nil {
+		start = max(start, sort.Search(len(idx.events), func(i int) bool { return idx.events[i].after(*after) }))
+	}
+	end := len(idx.events)
+	if !filter.To.IsZero() {
+		end = sort.Search(len(idx.events), func(i int) bool { return !idx.events[i].timestamp.Before(filter.To) })
+	}
+	if start >= end {
+		return nil
+	}
+
+	var candidates []int
+	switch {
+	case filter.OrgID != nil:
+		candidates = idx.orgs[*filter.OrgID]
+	case filter.BBox != nil:
+		candidates = idx.cellCandidates(*filter.BBox)
+	default:
+		candidates = make([]int, end-start)
+		for i := range candidates {
+			candidates[i] = start + i
+		}
+	}
+
+	var positions []int
+	first := sort.SearchInts(candidates, start)
+	for _, i := range candidates[first:] {
+		if i >= end {
+			break
+		}
+		e := idx.events[i]
+		if filter.OrgID != nil && e.orgID != *filter.OrgID {
+			continue
+		}
+		if filter.BBox != nil && (e.bound == nil || !filter.BBox.Intersects(*e.bound)) {
+			continue
+		}
+		positions = append(positions, i)
+	}
+	return positions
+}
+
+// cellCandidates returns the sorted positions of the events in the cells the
+// bounding box overlaps
+func (idx *memoryIndex) cellCandidates(bbox orb.Bound) []int {
+	seen := make(map[int]bool)
+	candidates := append([]int(nil), idx.large...)
+	minX, minY, maxX, maxY := cellRange(bbox)
+	for x := minX; x <= maxX; x++ {
+		for y := minY; y <= maxY; y++ {
+			for _, i := range idx.cells[memoryCell{x, y}] {
+				if !seen[i] {
+					seen[i] = true
+					candidates = append(candidates, i)
+				}
+			}
+		}
+	}
+	sort.Ints(candidates)
+	return candidates
+}
+
+// GetCollectionPage returns a page of the features matching the filter, ordered
+// by (source_event_timestamp, org_id, footprint MD5). The returned cursor points
+// at the last feature of the page and is nil when there are no more pages.
+func (s *MemoryStorage) GetCollectionPage(ctx context.Context, filter CollectionFilter, page PageRequest) (*geojson.FeatureCollection, *Cursor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	index := s.snapshot()
+	positions := index.search(filter, page.After)
+
+	var next *Cursor
+	if len(positions) > page.Limit {
+		positions = positions[:page.Limit]
+		cursor := index.events[positions[len(positions)-1]].cursor()
+		next = &cursor
+	}
+
+	fc := geojson.NewFeatureCollection()
+	for _, i := range positions {
+		f, err := geojson.UnmarshalFeature(index.events[i].footprint)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		fc.Append(f)
+	}
+	return fc, next, nil
+}
+
+// StreamCollection passes the features matching the filter to fn one at a
+// time. Iteration stops at the first error returned by fn.
+func (s *MemoryStorage) StreamCollection(ctx context.Context, filter CollectionFilter, fn func(*geojson.Feature) error) error {
+	index := s.snapshot()
+	for _, i := range index.search(filter, nil) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f, err := geojson.UnmarshalFeature(index.events[i].footprint)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrgIDs returns the IDs of the organizations with events
+func (s *MemoryStorage) GetOrgIDs(ctx context.Context) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	index := s.snapshot()
+	var orgIDs []int
+	for orgID := range index.orgs {
+		orgIDs = append(orgIDs, orgID)
+	}
+	sort.Ints(orgIDs)
+	return orgIDs, nil
+}
+
+// GetUsageSummary counts the events matching the filter and returns the
+// timestamps of the first and last of them
+func (s *MemoryStorage) GetUsageSummary(ctx context.Context, filter CollectionFilter) (UsageSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return UsageSummary{}, err
+	}
+	index := s.snapshot()
+	positions := index.search(filter, nil)
+	if len(positions) == 0 {
+		return UsageSummary{}, nil
+	}
+	return UsageSummary{
+		Count: len(positions),
+		First: index.events[positions[0]].timestamp,
+		Last:  index.events[positions[len(positions)-1]].timestamp,
+	}, nil
+}
+
+// GetDailyUsage counts the events matching the filter per UTC day
+func (s *MemoryStorage) GetDailyUsage(ctx context.Context, filter CollectionFilter) ([]DailyUsage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	index := s.snapshot()
+	var days []DailyUsage
+	for _, i := range index.search(filter, nil) {
+		t := index.events[i].timestamp
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		if len(days) > 0 && days[len(days)-1].Day.Equal(day) {
+			days[len(days)-1].Count++
+			continue
+		}
+		days = append(days, DailyUsage{Day: day, Count: 1})
+	}
+	return days, nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the memory storage
+func TestMemoryStorage(t *testing.T) {
+	testBackend(t, func(t *testing.T) backend { return NewMemoryStorage() })
+}
+
+// Test writes after a read are indexed by the next read
+func TestMemoryStorage_WriteAfterRead(t *testing.T) {
+	s := NewMemoryStorage()
+	writeTestEvents(t, s)
+
+	orgIDs, err := s.GetOrgIDs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, orgIDs)
+
+	// An earlier event of a new org goes first
+	event := testEvent(3, squareFootprint(13, 52))
+	event.Timestamp = testTimestamp.Add(-time.Hour)
+	_, err = s.WriteEvents(context.Background(), []UsageEvent{event})
+	assert.NoError(t, err)
+
+	orgIDs, err = s.GetOrgIDs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, orgIDs)
+
+	fc, _, err := s.GetCollectionPage(context.Background(), CollectionFilter{BBox: &orb.Bound{Min: orb.Point{13, 52}, Max: orb.Point{14, 53}}}, PageRequest{Limit: 1})
+	assert.NoError(t, err)
+	summary, err := s.GetUsageSummary(context.Background(), CollectionFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, fc.Features, 1)
+	assert.Equal(t, testTimestamp.Add(-time.Hour), summary.First)
+}
+
+// Test footprints spanning many cells of the spatial index are still found
+func TestMemoryStorage_LargeFootprint(t *testing.T) {
+	s := NewMemoryStorage()
+	large := `{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[-20,-20],[20,-20],[20,20],[-20,20],[-20,-20]]]},"properties":null}`
+	_, err := s.WriteEvents(context.Background(), []UsageEvent{testEvent(1, large), testEvent(2, emptyFeature)})
+	assert.NoError(t, err)
+
+	features, err := streamFeatures(s, CollectionFilter{BBox: &orb.Bound{Min: orb.Point{5, 5}, Max: orb.Point{5.5, 5.5}}})
+	assert.NoError(t, err)
+	assert.Len(t, features, 1)
+}
+
+// Test callers get their own copy of the features
+func TestMemoryStorage_FeatureCopies(t *testing.T) {
+	s := NewMemoryStorage()
+	writeTestEvents(t, s)
+
+	err := s.StreamCollection(context.Background(), CollectionFilter{}, func(f *geojson.Feature) error {
+		f.Geometry.(orb.Polygon)[0][0] = orb.Point{0, 0}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	features, err := streamFeatures(s, CollectionFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, orb.Point{13, 52}, features[0].Geometry.(orb.Polygon)[0][0])
+}
+
+// Test events whose Unix nanoseconds wrap around to the same value are kept
+func TestMemoryStorage_DistantTimestamps(t *testing.T) {
+	s := NewMemoryStorage()
+	first := testEvent(1, squareFootprint(13, 52))
+	first.Timestamp = time.Date(1800, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first
+	second.Timestamp = first.Timestamp.Add(time.Duration(math.MaxInt64)).Add(time.Duration(math.MaxInt64)).Add(2)
+
+	inserted, err := s.WriteEvents(context.Background(), []UsageEvent{first, second})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), inserted)
+}
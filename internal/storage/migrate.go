@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaVersion is returned when the database schema is not at the version
+// this build of the application was written for
+var ErrSchemaVersion = errors.New("unsupported schema version")
+
+// Migration is a numbered schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator applies the embedded migrations and keeps track of them in the
+// schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// loadMigrations reads the NNNN_name.up.sql and NNNN_name.down.sql files and
+// returns the migrations ordered by version
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, name := range names {
+		base := path.Base(name)
+		stem, direction, found := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !found || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", base)
+		}
+		number, title, found := strings.Cut(stem, "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name %q", base)
+		}
+		version, err := strconv.Atoi(number)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %q", base)
+		}
+
+		content, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d is missing its up or down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Latest returns the version of the newest embedded migration
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version returns the version the database schema is at, 0 when no migration
+// has been applied yet
+func (m *Migrator) Version() (int, error) {
+	var exists bool
+	if err := m.db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL;").Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	if err := m.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations;").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// CheckVersion returns ErrSchemaVersion unless the database schema is at the
+// latest embedded migration
+func (m *Migrator) CheckVersion() error {
+	version, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if version != m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, expected %d", ErrSchemaVersion, version, m.Latest())
+	}
+	return nil
+}
+
+// Up applies all pending migrations and returns the number applied
+func (m *Migrator) Up() (int, error) {
+	version, err := m.prepare()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, migration := range m.migrations[version:] {
+		log.Printf("Applying migration %d %s", migration.Version, migration.Name)
+		err := m.apply(migration.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2);", migration.Version, migration.Name)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// Down reverts up to steps migrations, newest first, and returns the number reverted
+func (m *Migrator) Down(steps int) (int, error) {
+	version, err := m.prepare()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for ; reverted < steps && version > 0; version-- {
+		migration := m.migrations[version-1]
+		log.Printf("Reverting migration %d %s", migration.Version, migration.Name)
+		err := m.apply(migration.Down, "DELETE FROM schema_migrations WHERE version = $1;", migration.Version)
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		reverted++
+	}
+	return reverted, nil
+}
+
+// prepare creates the schema_migrations table and returns the current version.
+// Databases at a version newer than the embedded migrations are refused.
+func (m *Migrator) prepare() (int, error) {
+	_, err := m.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version Int PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		);
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+	if version > m.Latest() {
+		return 0, fmt.Errorf("%w: database is at version %d, newest known is %d", ErrSchemaVersion, version, m.Latest())
+	}
+	return version, nil
+}
+
+// apply runs the migration SQL and records it in a single transaction
+func (m *Migrator) apply(migration string, record string, args ...interface{}) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
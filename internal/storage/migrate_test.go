@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the embedded migrations are complete and ordered
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version)
+		assert.NotEmpty(t, migration.Name)
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+	assert.Equal(t, "create_data", migrations[0].Name)
+}
+
+// Test invalid migration sets are rejected
+func TestLoadMigrations_Invalid(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"migrations/0001_a.up.sql": file,
+		},
+		"gap": {
+			"migrations/0001_a.up.sql":   file,
+			"migrations/0001_a.down.sql": file,
+			"migrations/0003_c.up.sql":   file,
+			"migrations/0003_c.down.sql": file,
+		},
+		"bad name": {
+			"migrations/first.up.sql":   file,
+			"migrations/first.down.sql": file,
+		},
+		"bad direction": {
+			"migrations/0001_a.sideways.sql": file,
+		},
+	}
+
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadMigrations(files)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// newTestMigrator returns a migrator with two trivial migrations
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	migrations := []Migration{
+		{Version: 1, Name: "first", Up: "CREATE TABLE first", Down: "DROP TABLE first"},
+		{Version: 2, Name: "second", Up: "CREATE TABLE second", Down: "DROP TABLE second"},
+	}
+	return &Migrator{db: db, migrations: migrations}, mock
+}
+
+// expectVersion mocks the schema version queries
+func expectVersion(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectQuery("SELECT to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+// Test Up applies only the pending migrations
+func TestMigrator_Up(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE second").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(2, "second").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	applied, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test Up rolls back a failing migration
+func TestMigrator_Up_Error(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, 0)
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE first").WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+
+	applied, err := migrator.Up()
+	assert.Error(t, err)
+	assert.Equal(t, 0, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test Up refuses a schema newer than the known migrations
+func TestMigrator_Up_NewerSchema(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, 3)
+
+	_, err := migrator.Up()
+	assert.True(t, errors.Is(err, ErrSchemaVersion))
+}
+
+// Test Down reverts the newest migrations first
+func TestMigrator_Down(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP TABLE second").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP TABLE first").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reverted, err := migrator.Down(5)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reverted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test CheckVersion accepts only the latest version
+func TestMigrator_CheckVersion(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	expectVersion(mock, 2)
+	assert.NoError(t, migrator.CheckVersion())
+
+	expectVersion(mock, 1)
+	assert.True(t, errors.Is(migrator.CheckVersion(), ErrSchemaVersion))
+
+	mock.ExpectQuery("SELECT to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	assert.True(t, errors.Is(migrator.CheckVersion(), ErrSchemaVersion))
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS data (
+	org_id Int,
+	footprints_used JSONB,
+	source_event_timestamp timestamptz
+);
+CREATE INDEX IF NOT EXISTS data_timestamp_org_idx ON data (source_event_timestamp, org_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS data_dedup_idx;
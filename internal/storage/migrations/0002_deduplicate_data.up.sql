@@ -0,0 +1,8 @@
+-- Remove the duplicates loaded before rows were unique
+DELETE FROM data a USING data b
+WHERE a.ctid < b.ctid
+AND a.org_id = b.org_id
+AND a.source_event_timestamp = b.source_event_timestamp
+AND md5(a.footprints_used::text) = md5(b.footprints_used::text);
+
+CREATE UNIQUE INDEX IF NOT EXISTS data_dedup_idx ON data (org_id, source_event_timestamp, md5(footprints_used::text));
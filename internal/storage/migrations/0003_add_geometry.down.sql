@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS data_geom_idx;
+ALTER TABLE data DROP COLUMN IF EXISTS geom;
@@ -0,0 +1,13 @@
+-- The geometry column is only added when PostGIS can be installed,
+-- otherwise bounding boxes are filtered by the API
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'postgis') THEN
+		CREATE EXTENSION IF NOT EXISTS postgis;
+		EXECUTE 'ALTER TABLE data ADD COLUMN IF NOT EXISTS geom geometry(Geometry, 4326)';
+		-- Rows loaded before the column existed would drop out of spatial queries
+		EXECUTE 'UPDATE data SET geom = ST_SetSRID(ST_GeomFromGeoJSON(footprints_used->>''geometry''), 4326)
+			WHERE geom IS NULL AND jsonb_typeof(footprints_used->''geometry'') = ''object''';
+		EXECUTE 'CREATE INDEX IF NOT EXISTS data_geom_idx ON data USING GIST (geom)';
+	END IF;
+END $$;
@@ -0,0 +1,7 @@
+-- Progress of interrupted loads, keyed by the SHA-256 of the loaded file
+CREATE TABLE IF NOT EXISTS load_checkpoints (
+	checksum Text PRIMARY KEY,
+	file_path Text NOT NULL,
+	line Int NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS data_timestamp_org_idx ON data (source_event_timestamp, org_id);
+DROP INDEX IF EXISTS data_page_idx;
@@ -0,0 +1,4 @@
+-- Pages are ordered by a unique key, so rows sharing a timestamp and an
+-- organization are not lost between two pages
+CREATE INDEX IF NOT EXISTS data_page_idx ON data (source_event_timestamp, org_id, md5(footprints_used::text));
+DROP INDEX IF EXISTS data_timestamp_org_idx;
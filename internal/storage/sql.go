@@ -1,41 +1,143 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"github.com/paulmach/orb/encoding/ewkb"
 	"github.com/paulmach/orb/geojson"
 	"log"
 	"strings"
-	"time"
 )
 
 type SqlStorage struct {
-	db *sql.DB
+	db      *sql.DB
+	postgis bool // spatial filtering happens in the database
 }
 
 func NewSqlStorage(db *sql.DB) *SqlStorage {
 	return &SqlStorage{db: db}
 }
 
-// GetCollection queries the entities from the db and reads the entities
-// directly in a geojson.Feature and returns a geojson.FeatureCollection
-func (s *SqlStorage) GetCollection() (*geojson.FeatureCollection, error) {
-	// Query db
-	rows, err := s.db.Query("SELECT footprints_used FROM data;")
+// DetectPostGIS checks whether PostGIS is installed and the data table has a
+// geometry column. Without it bounding box filters are applied in Go.
+func (s *SqlStorage) DetectPostGIS() error {
+	postgis, err := HasGeometryColumn(s.db)
+	if err != nil {
+		return err
+	}
+	if !postgis {
+		log.Println("PostGIS geometry column not found, filtering bounding boxes in Go")
+	}
+	s.postgis = postgis
+	return nil
+}
+
+// HasGeometryColumn reports whether the data table has the PostGIS geometry
+// column, which the migrations only add when PostGIS is available
+func HasGeometryColumn(db *sql.DB) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1
+			FROM information_schema.columns
+			WHERE table_name = 'data' AND column_name = 'geom'
+		);
+	`).Scan(&exists)
+	return exists, err
+}
+
+// pageOrder is the unique order of the pages, it matches data_page_idx
+const pageOrder = "source_event_timestamp, org_id, md5(footprints_used::text)"
+
+// GetCollectionPage returns a page of the features matching the filter, ordered
+// by (source_event_timestamp, org_id, footprint MD5). The returned cursor points
+// at the last feature of the page and is nil when there are no more pages.
+func (s *SqlStorage) GetCollectionPage(ctx context.Context, filter CollectionFilter, page PageRequest) (*geojson.FeatureCollection, *Cursor, error) {
+	fc := geojson.NewFeatureCollection()
+	var last *Cursor
+	after := page.After
+	for {
+		// Fetch one extra row to find out whether a next page exists
+		rows, err := s.pageRows(ctx, filter, after, page.Limit+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, r := range rows {
+			f, err := geojson.UnmarshalFeature(r.payload)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if !s.postgis && !filter.matchesBound(f) {
+				continue
+			}
+			if len(fc.Features) == page.Limit {
+				return fc, last, nil
+			}
+			fc.Append(f)
+			last = &r.cursor
+		}
+
+		// Rows left out by the bounding box filter in Go are made up for with
+		// the following rows, until the table has no more
+		if len(rows) <= page.Limit {
+			return fc, nil, nil
+		}
+		after = &rows[len(rows)-1].cursor
+	}
+}
+
+// pageRow is a row read for a page and its position in the order of pages
+type pageRow struct {
+	cursor  Cursor
+	payload []byte
+}
+
+// pageRows reads up to limit rows matching the filter that follow after
+func (s *SqlStorage) pageRows(ctx context.Context, filter CollectionFilter, after *Cursor, limit int) ([]pageRow, error) {
+	conditions, args := filter.conditions(s.postgis)
+	if after != nil {
+		args = append(args, after.Timestamp.UTC(), after.OrgID, after.FootprintMD5)
+		conditions = append(conditions, fmt.Sprintf("(%s) > ($%d, $%d, $%d)", pageOrder, len(args)-2, len(args)-1, len(args)))
+	}
+	args = append(args, limit)
+	query := "SELECT org_id, footprints_used, source_event_timestamp, md5(footprints_used::text) FROM data" + joinConditions(conditions) +
+		fmt.Sprintf(" ORDER BY %s LIMIT $%d;", pageOrder, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	// Create FeatureCollection
-	fc := geojson.NewFeatureCollection()
+	var page []pageRow
+	for rows.Next() {
+		var r pageRow
+		if err := rows.Scan(&r.cursor.OrgID, &r.payload, &r.cursor.Timestamp, &r.cursor.FootprintMD5); err != nil {
+			return nil, err
+		}
+		page = append(page, r)
+	}
+
+	return page, rows.Err()
+}
+
+// StreamCollection reads the features matching the filter one row at a time and
+// passes each of them to fn. Iteration stops at the first error returned by fn.
+func (s *SqlStorage) StreamCollection(ctx context.Context, filter CollectionFilter, fn func(*geojson.Feature) error) error {
+	where, args := filter.whereClause(s.postgis)
+	rows, err := s.db.QueryContext(ctx, "SELECT footprints_used FROM data"+where+";", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	// Populate collection with features
 	for rows.Next() {
 		var payload []byte
 
-		err := rows.Scan(&payload)
-		if err != nil {
+		if err := rows.Scan(&payload); err != nil {
 			log.Println(err)
 			continue
 		}
@@ -44,16 +146,21 @@ func (s *SqlStorage) GetCollection() (*geojson.FeatureCollection, error) {
 			log.Println(err)
 			continue
 		}
+		if !s.postgis && !filter.matchesBound(f) {
+			continue
+		}
 
-		fc.Append(f)
+		if err := fn(f); err != nil {
+			return err
+		}
 	}
 
-	return fc, nil
+	return rows.Err()
 }
 
 // GetOrgIDs fetches the Org IDs from the DB and returns a slice of int
-func (s *SqlStorage) GetOrgIDs() ([]int, error) {
-	rows, err := s.db.Query(`
+func (s *SqlStorage) GetOrgIDs(ctx context.Context) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
 		SELECT DISTINCT org_id 
 		FROM data 
 		WHERE footprints_used IS NOT NULL 
@@ -74,46 +181,144 @@ func (s *SqlStorage) GetOrgIDs() ([]int, error) {
 		orgIDs = append(orgIDs, orgID)
 	}
 
-	return orgIDs, nil
+	return orgIDs, rows.Err()
 }
 
-// CreateTable creates the data table in the database if it doesn't exist
-func CreateTable(db *sql.DB) error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS data (
-			org_id Int,
-			footprints_used JSONB,
-			source_event_timestamp timestamptz
-		);
-	`)
+// GetUsageSummary counts the events matching the filter and returns the
+// timestamps of the first and last of them
+func (s *SqlStorage) GetUsageSummary(ctx context.Context, filter CollectionFilter) (UsageSummary, error) {
+	where, args := filter.whereClause(s.postgis)
+	query := "SELECT COUNT(*), MIN(source_event_timestamp), MAX(source_event_timestamp) FROM data" + where + ";"
+
+	var summary UsageSummary
+	var first, last sql.NullTime
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&summary.Count, &first, &last); err != nil {
+		return UsageSummary{}, err
+	}
+	summary.First = first.Time
+	summary.Last = last.Time
+
+	return summary, nil
+}
+
+// GetDailyUsage counts the events matching the filter per UTC day
+func (s *SqlStorage) GetDailyUsage(ctx context.Context, filter CollectionFilter) ([]DailyUsage, error) {
+	where, args := filter.whereClause(s.postgis)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT date_trunc('day', source_event_timestamp AT TIME ZONE 'UTC') AS day, COUNT(*)
+		FROM data`+where+`
+		GROUP BY day
+		ORDER BY day;
+	`, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	var days []DailyUsage
+	for rows.Next() {
+		var day DailyUsage
+		if err := rows.Scan(&day.Day, &day.Count); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return days, nil
+}
+
+// BatchInserter writes a batch of usage events to the database and returns
+// the number of rows inserted. Duplicate rows are skipped.
+type BatchInserter func(ctx context.Context, db *sql.DB, batch []UsageEvent) (int64, error)
+
+// onConflict skips rows that were already loaded
+const onConflict = " ON CONFLICT (org_id, source_event_timestamp, md5(footprints_used::text)) DO NOTHING"
+
+// loadColumns are the columns the loader writes, geom is added when spatial
+var loadColumns = []string{"org_id", "footprints_used", "source_event_timestamp"}
+
+// columnList returns the loaded columns as a comma separated list
+func columnList(spatial bool) string {
+	list := strings.Join(loadColumns, ", ")
+	if spatial {
+		list += ", geom"
+	}
+	return list
 }
 
-// InsertBatch inserts a batch of records into the database
-func InsertBatch(db *sql.DB, batch [][]string) error {
-	query := "INSERT INTO data (org_id, footprints_used, source_event_timestamp) VALUES "
+// eventValues returns the values of the loaded columns for an event
+func eventValues(event UsageEvent, spatial bool) ([]interface{}, error) {
+	if event.Footprint == nil {
+		return nil, fmt.Errorf("%s line %d: event has no footprint", event.SourceFile, event.LineNo)
+	}
+	footprint, err := event.Footprint.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("%s line %d: encoding footprint: %w", event.SourceFile, event.LineNo, err)
+	}
+
+	values := []interface{}{event.OrgID, string(footprint), event.Timestamp.UTC()}
+	if spatial {
+		values = append(values, footprintGeometry(event.Footprint))
+	}
+	return values, nil
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// InsertBatch inserts a batch of events into the database
+func InsertBatch(ctx context.Context, db *sql.DB, batch []UsageEvent) (int64, error) {
+	return insertBatch(ctx, db, "data", onConflict, batch, false)
+}
+
+// InsertSpatialBatch inserts a batch of events and fills the PostGIS geometry
+// column from the footprint
+func InsertSpatialBatch(ctx context.Context, db *sql.DB, batch []UsageEvent) (int64, error) {
+	return insertBatch(ctx, db, "data", onConflict, batch, true)
+}
+
+// insertBatch inserts the events into table, suffix ends the statement
+func insertBatch(ctx context.Context, db execer, table, suffix string, batch []UsageEvent, spatial bool) (int64, error) {
+	query := "INSERT INTO " + table + " (" + columnList(spatial) + ") VALUES "
 	values := []string{}
 	args := []interface{}{}
-	argCount := 1
 
-	for _, record := range batch {
-		timestampStr := record[2]
-		parsedTime, err := time.Parse(time.RFC3339, timestampStr)
+	for _, event := range batch {
+		row, err := eventValues(event, spatial)
 		if err != nil {
-			log.Println("Skipping invalid timestamp:", timestampStr)
-			continue
+			return 0, err
 		}
-		utcTime := parsedTime.UTC()
 
-		values = append(values, fmt.Sprintf("($%d, $%d, $%d)", argCount, argCount+1, argCount+2))
-		args = append(args, record[0], record[1], utcTime)
-		argCount += 3
+		placeholders := make([]string, len(row))
+		for i := range row {
+			placeholders[i] = fmt.Sprintf("$%d", len(args)+i+1)
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+		args = append(args, row...)
 	}
 
-	query += strings.Join(values, ",")
-	_, err := db.Exec(query, args...)
-	return err
+	query += strings.Join(values, ",") + suffix
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// footprintGeometry returns the geometry of the footprint as hex encoded
+// EWKB, or nil when the footprint has no usable geometry
+func footprintGeometry(f *geojson.Feature) interface{} {
+	if f.Geometry == nil {
+		return nil
+	}
+	geom, err := ewkb.MarshalToHex(f.Geometry, 4326)
+	if err != nil {
+		return nil
+	}
+	return geom
 }
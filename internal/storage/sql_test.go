@@ -1,14 +1,33 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
 	"github.com/stretchr/testify/assert"
 )
 
+// emptyFeature is a footprint without geometry, as it is encoded
+const emptyFeature = `{"type":"Feature","geometry":null,"properties":null}`
+
+// testTimestamp is the timestamp of the test events
+var testTimestamp = time.Date(2025, 2, 9, 15, 4, 5, 0, time.UTC)
+
+// testEvent returns an event of the org with the footprint
+func testEvent(orgID int64, footprint string) UsageEvent {
+	f, err := geojson.UnmarshalFeature([]byte(footprint))
+	if err != nil {
+		panic(err)
+	}
+	return UsageEvent{OrgID: orgID, Footprint: f, Timestamp: testTimestamp, SourceFile: "sample.csv", LineNo: 2}
+}
+
 func TestInsertBatch(t *testing.T) {
 	// Mock DB setup
 	db, mock, err := sqlmock.New()
@@ -18,22 +37,17 @@ func TestInsertBatch(t *testing.T) {
 	defer db.Close()
 
 	// Mock the execution of the insert query
-	timestampStr := "2025-02-09T15:04:05Z"
-	parsedTime, _ := time.Parse(time.RFC3339, timestampStr)
-	utcTime := parsedTime.UTC()
-
 	mock.ExpectExec("INSERT INTO data").
-		WithArgs("1", `{"type":"Feature"}`, utcTime).
+		WithArgs(int64(1), emptyFeature, testTimestamp).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// Test data
-	batch := [][]string{
-		{"1", `{"type":"Feature"}`, "2025-02-09T15:04:05Z"},
-	}
+	batch := []UsageEvent{testEvent(1, emptyFeature)}
 
 	// Call the insertBatch function
-	err = InsertBatch(db, batch)
+	inserted, err := InsertBatch(context.Background(), db, batch)
 	assert.NoError(t, err)
+	assert.Equal(t, int64(1), inserted)
 
 	// Ensure that all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -41,57 +55,300 @@ func TestInsertBatch(t *testing.T) {
 	}
 }
 
-// Test InsertBatch with invalid timestamp
-func TestInsertBatch_InvalidTimestamp(t *testing.T) {
-	db, _, err := sqlmock.New()
+// Test InsertBatch skips rows that were already loaded
+func TestInsertBatch_Duplicates(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
-	batch := [][]string{
-		{"1", `{"type":"Feature"}`, "invalid-timestamp"},
-	}
+	mock.ExpectExec(`INSERT INTO data .* ON CONFLICT \(org_id, source_event_timestamp, md5\(footprints_used::text\)\) DO NOTHING`).
+		WithArgs(int64(1), emptyFeature, testTimestamp, int64(1), emptyFeature, testTimestamp).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	batch := []UsageEvent{testEvent(1, emptyFeature), testEvent(1, emptyFeature)}
 
-	// Since the function skips invalid timestamps, we do not expect any query execution
-	err = InsertBatch(db, batch)
+	inserted, err := InsertBatch(context.Background(), db, batch)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), inserted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test InsertBatch rejects events without a footprint before querying
+func TestInsertBatch_MissingFootprint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	event := testEvent(1, emptyFeature)
+	event.Footprint = nil
+
+	_, err = InsertBatch(context.Background(), db, []UsageEvent{event})
 	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "sample.csv line 2")
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-// Test GetCollection function
-func TestGetCollection(t *testing.T) {
+// Test StreamCollection with query error
+func TestStreamCollection_QueryError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSqlStorage(db)
+
+	mock.ExpectQuery("SELECT footprints_used FROM data;").WillReturnError(sql.ErrNoRows)
+
+	features, err := streamFeatures(storage, CollectionFilter{})
+	assert.Error(t, err)
+	assert.Nil(t, features)
+}
+
+// Test StreamCollection with all filters set
+func TestStreamCollection_Filter(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
 	sqlStorage := NewSqlStorage(db)
 
-	// Mock rows
+	orgID := 6
+	from := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC)
+
 	rows := sqlmock.NewRows([]string{"footprints_used"}).
 		AddRow([]byte(`{"type":"Feature"}`))
 
-	mock.ExpectQuery("SELECT footprints_used FROM data;").WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT footprints_used FROM data WHERE org_id = \$1 AND source_event_timestamp >= \$2 AND source_event_timestamp < \$3;`).
+		WithArgs(orgID, from, to).
+		WillReturnRows(rows)
+
+	features, err := streamFeatures(sqlStorage, CollectionFilter{OrgID: &orgID, From: from, To: to})
 
-	fc, err := sqlStorage.GetCollection()
+	assert.NoError(t, err)
+	assert.Len(t, features, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
+// Test StreamCollection with only an organization filter
+func TestStreamCollection_OrgOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
-	assert.Equal(t, "Feature", fc.Features[0].Type)
+	defer db.Close()
+
+	sqlStorage := NewSqlStorage(db)
+
+	orgID := 33
+	mock.ExpectQuery(`SELECT footprints_used FROM data WHERE org_id = \$1;`).
+		WithArgs(orgID).
+		WillReturnRows(sqlmock.NewRows([]string{"footprints_used"}))
+
+	features, err := streamFeatures(sqlStorage, CollectionFilter{OrgID: &orgID})
 
-	// Ensure all expectations were met
+	assert.NoError(t, err)
+	assert.Empty(t, features)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-// Test GetCollection with query error
-func TestGetCollection_Error(t *testing.T) {
+// Test GetCollectionPage returns a cursor when more rows exist
+func TestGetCollectionPage(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
-	storage := NewSqlStorage(db)
+	sqlStorage := NewSqlStorage(db)
 
-	mock.ExpectQuery("SELECT footprints_used FROM data;").WillReturnError(sql.ErrNoRows)
+	first := time.Date(2024, 7, 1, 4, 0, 28, 0, time.UTC)
+	second := time.Date(2024, 7, 1, 4, 1, 21, 0, time.UTC)
+	after := &Cursor{Timestamp: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), OrgID: 1, FootprintMD5: "0a"}
+
+	// The last two rows share the timestamp and the organization
+	rows := sqlmock.NewRows([]string{"org_id", "footprints_used", "source_event_timestamp", "md5"}).
+		AddRow(6, []byte(`{"type":"Feature"}`), first, "0a").
+		AddRow(33, []byte(`{"type":"Feature"}`), second, "1b").
+		AddRow(33, []byte(`{"type":"Feature"}`), second, "2c")
+
+	mock.ExpectQuery(`SELECT org_id, footprints_used, source_event_timestamp, md5\(footprints_used::text\) FROM data `+
+		`WHERE \(source_event_timestamp, org_id, md5\(footprints_used::text\)\) > \(\$1, \$2, \$3\) `+
+		`ORDER BY source_event_timestamp, org_id, md5\(footprints_used::text\) LIMIT \$4;`).
+		WithArgs(after.Timestamp, after.OrgID, after.FootprintMD5, 3).
+		WillReturnRows(rows)
+
+	fc, next, err := sqlStorage.GetCollectionPage(context.Background(), CollectionFilter{}, PageRequest{Limit: 2, After: after})
+
+	assert.NoError(t, err)
+	assert.Len(t, fc.Features, 2)
+	assert.Equal(t, &Cursor{Timestamp: second, OrgID: 33, FootprintMD5: "1b"}, next)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test GetCollectionPage on the last page
+func TestGetCollectionPage_LastPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sqlStorage := NewSqlStorage(db)
+
+	orgID := 6
+	rows := sqlmock.NewRows([]string{"org_id", "footprints_used", "source_event_timestamp", "md5"}).
+		AddRow(6, []byte(`{"type":"Feature"}`), time.Now(), "0a")
+
+	mock.ExpectQuery(`SELECT .* FROM data WHERE org_id = \$1 ORDER BY source_event_timestamp, org_id, md5\(footprints_used::text\) LIMIT \$2;`).
+		WithArgs(orgID, 11).
+		WillReturnRows(rows)
+
+	fc, next, err := sqlStorage.GetCollectionPage(context.Background(), CollectionFilter{OrgID: &orgID}, PageRequest{Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Len(t, fc.Features, 1)
+	assert.Nil(t, next)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test GetCollectionPage reads on when the bounding box filter in Go leaves
+// out rows, so the page is full and its cursor leads to a matching feature
+func TestGetCollectionPage_BBoxFallback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sqlStorage := NewSqlStorage(db)
+
+	inside := []byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[13.35,52.45]},"properties":null}`)
+	outside := []byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[-74,40]},"properties":null}`)
+	columns := []string{"org_id", "footprints_used", "source_event_timestamp", "md5"}
+	bbox := orb.Bound{Min: orb.Point{13, 52}, Max: orb.Point{14, 53}}
+
+	mock.ExpectQuery(`SELECT .* FROM data ORDER BY .* LIMIT \$1;`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, outside, testTimestamp, "0a").AddRow(2, inside, testTimestamp, "1b"))
+	mock.ExpectQuery(`SELECT .* FROM data WHERE .* > \(\$1, \$2, \$3\) ORDER BY .* LIMIT \$4;`).
+		WithArgs(testTimestamp, 2, "1b", 2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, outside, testTimestamp, "2c").AddRow(4, inside, testTimestamp, "3d"))
+
+	fc, next, err := sqlStorage.GetCollectionPage(context.Background(), CollectionFilter{BBox: &bbox}, PageRequest{Limit: 1})
+
+	assert.NoError(t, err)
+	assert.Len(t, fc.Features, 1)
+	assert.Equal(t, &Cursor{Timestamp: testTimestamp, OrgID: 2, FootprintMD5: "1b"}, next)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test StreamCollection passes every feature to the callback
+func TestStreamCollection(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sqlStorage := NewSqlStorage(db)
+
+	rows := sqlmock.NewRows([]string{"footprints_used"}).
+		AddRow([]byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]}}`)).
+		AddRow([]byte(`not json`)).
+		AddRow([]byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]}}`))
+	mock.ExpectQuery("SELECT footprints_used FROM data;").WillReturnRows(rows)
+
+	var count int
+	err = sqlStorage.StreamCollection(context.Background(), CollectionFilter{}, func(f *geojson.Feature) error {
+		count++
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test StreamCollection stops when the callback fails
+func TestStreamCollection_CallbackError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sqlStorage := NewSqlStorage(db)
+
+	rows := sqlmock.NewRows([]string{"footprints_used"}).
+		AddRow([]byte(`{"type":"Feature"}`)).
+		AddRow([]byte(`{"type":"Feature"}`))
+	mock.ExpectQuery("SELECT footprints_used FROM data;").WillReturnRows(rows)
+
+	var count int
+	err = sqlStorage.StreamCollection(context.Background(), CollectionFilter{}, func(f *geojson.Feature) error {
+		count++
+		return errors.New("client gone")
+	})
 
-	featureCollection, err := storage.GetCollection()
 	assert.Error(t, err)
-	assert.Nil(t, featureCollection)
+	assert.Equal(t, 1, count)
+}
+
+// Test StreamCollection filters the bounding box in Go without PostGIS
+func TestStreamCollection_BBoxFallback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sqlStorage := NewSqlStorage(db)
+
+	rows := sqlmock.NewRows([]string{"footprints_used"}).
+		AddRow([]byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[13.35,52.45]}}`)).
+		AddRow([]byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[2.35,48.85]}}`)).
+		AddRow([]byte(`{"type":"Feature","geometry":null}`))
+	mock.ExpectQuery("SELECT footprints_used FROM data;").WillReturnRows(rows)
+
+	bbox := orb.Bound{Min: orb.Point{13, 52}, Max: orb.Point{14, 53}}
+	var features []*geojson.Feature
+	err = sqlStorage.StreamCollection(context.Background(), CollectionFilter{BBox: &bbox}, func(f *geojson.Feature) error {
+		features = append(features, f)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, features, 1)
+	assert.Equal(t, orb.Point{13.35, 52.45}, features[0].Geometry)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test StreamCollection filters the bounding box in the database with PostGIS
+func TestStreamCollection_BBoxPostGIS(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sqlStorage := NewSqlStorage(db)
+	sqlStorage.postgis = true
+
+	rows := sqlmock.NewRows([]string{"footprints_used"}).
+		AddRow([]byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[2.35,48.85]}}`))
+	mock.ExpectQuery(`SELECT footprints_used FROM data WHERE ST_Intersects\(geom, ST_MakeEnvelope\(\$1, \$2, \$3, \$4, 4326\)\);`).
+		WithArgs(13.0, 52.0, 14.0, 53.0).
+		WillReturnRows(rows)
+
+	bbox := orb.Bound{Min: orb.Point{13, 52}, Max: orb.Point{14, 53}}
+	var count int
+	err = sqlStorage.StreamCollection(context.Background(), CollectionFilter{BBox: &bbox}, func(f *geojson.Feature) error {
+		count++
+		return nil
+	})
+
+	// The database result is trusted as is
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test DetectPostGIS function
+func TestDetectPostGIS(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sqlStorage := NewSqlStorage(db)
+
+	mock.ExpectQuery("SELECT EXISTS").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	assert.NoError(t, sqlStorage.DetectPostGIS())
+	assert.True(t, sqlStorage.postgis)
 }
 
 // Test GetOrgIDs function
@@ -105,7 +362,7 @@ func TestGetOrgIDs(t *testing.T) {
 	rows := sqlmock.NewRows([]string{"org_id"}).AddRow(1).AddRow(2)
 	mock.ExpectQuery("SELECT DISTINCT org_id FROM data").WillReturnRows(rows)
 
-	orgIDs, err := storage.GetOrgIDs()
+	orgIDs, err := storage.GetOrgIDs(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, []int{1, 2}, orgIDs)
 
@@ -122,33 +379,103 @@ func TestGetOrgIDs_Error(t *testing.T) {
 
 	mock.ExpectQuery("SELECT DISTINCT org_id FROM data").WillReturnError(sql.ErrConnDone)
 
-	orgIDs, err := storage.GetOrgIDs()
+	orgIDs, err := storage.GetOrgIDs(context.Background())
 	assert.Error(t, err)
 	assert.Nil(t, orgIDs)
 }
 
-// Test CreateTable function
-func TestCreateTable(t *testing.T) {
+// Test GetOrgIDs when the deadline of the request has passed
+func TestGetOrgIDs_DeadlineExceeded(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSqlStorage(db)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	orgIDs, err := storage.GetOrgIDs(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Nil(t, orgIDs)
+}
+
+// Test GetUsageSummary function
+func TestGetUsageSummary(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSqlStorage(db)
+
+	orgID := 6
+	first := time.Date(2024, 7, 1, 4, 0, 28, 0, time.UTC)
+	last := time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"count", "min", "max"}).AddRow(12, first, last)
+	mock.ExpectQuery(`SELECT COUNT\(\*\), MIN\(source_event_timestamp\), MAX\(source_event_timestamp\) FROM data WHERE org_id = \$1;`).
+		WithArgs(orgID).
+		WillReturnRows(rows)
+
+	summary, err := storage.GetUsageSummary(context.Background(), CollectionFilter{OrgID: &orgID})
+	assert.NoError(t, err)
+	assert.Equal(t, UsageSummary{Count: 12, First: first, Last: last}, summary)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test GetUsageSummary without matching events
+func TestGetUsageSummary_Empty(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
-	mock.ExpectExec("CREATE TABLE IF NOT EXISTS data").WillReturnResult(sqlmock.NewResult(1, 1))
+	storage := NewSqlStorage(db)
+
+	rows := sqlmock.NewRows([]string{"count", "min", "max"}).AddRow(0, nil, nil)
+	mock.ExpectQuery("SELECT COUNT").WillReturnRows(rows)
+
+	summary, err := storage.GetUsageSummary(context.Background(), CollectionFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, UsageSummary{}, summary)
+}
 
-	err = CreateTable(db)
+// Test GetDailyUsage function
+func TestGetDailyUsage(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSqlStorage(db)
+
+	orgID := 6
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"day", "count"}).AddRow(day, 12)
+	mock.ExpectQuery(`SELECT date_trunc\('day', source_event_timestamp AT TIME ZONE 'UTC'\) AS day, COUNT\(\*\)\s+FROM data WHERE org_id = \$1\s+GROUP BY day`).
+		WithArgs(orgID).
+		WillReturnRows(rows)
 
+	days, err := storage.GetDailyUsage(context.Background(), CollectionFilter{OrgID: &orgID})
+	assert.NoError(t, err)
+	assert.Equal(t, []DailyUsage{{Day: day, Count: 12}}, days)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-// Test CreateTable with error
-func TestCreateTable_Error(t *testing.T) {
+// Test InsertSpatialBatch fills the geometry column
+func TestInsertSpatialBatch(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
-	mock.ExpectExec("CREATE TABLE IF NOT EXISTS data").WillReturnError(sql.ErrConnDone)
+	footprint := `{"type":"Feature","geometry":{"type":"Point","coordinates":[13.35,52.45]},"properties":null}`
+	batch := []UsageEvent{testEvent(1, footprint), testEvent(2, emptyFeature)}
+	geom := footprintGeometry(batch[0].Footprint)
+	assert.NotNil(t, geom)
 
-	err = CreateTable(db)
-	assert.Error(t, err)
+	mock.ExpectExec(`INSERT INTO data \(org_id, footprints_used, source_event_timestamp, geom\) VALUES \(\$1, \$2, \$3, \$4\),\(\$5, \$6, \$7, \$8\)`).
+		WithArgs(int64(1), footprint, testTimestamp, geom, int64(2), emptyFeature, testTimestamp, nil).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+
+	inserted, err := InsertSpatialBatch(context.Background(), db, batch)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), inserted)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
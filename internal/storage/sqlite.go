@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/paulmach/orb/geojson"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of a SQLite database. Timestamps are stored
+// as Unix microseconds and the bounding box of every footprint is stored with
+// it, so time and bounding box filters run in SQL without PostGIS.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS data (
+	org_id INTEGER NOT NULL,
+	footprints_used TEXT NOT NULL,
+	source_event_timestamp INTEGER NOT NULL,
+	footprint_md5 TEXT NOT NULL,
+	min_lon REAL,
+	min_lat REAL,
+	max_lon REAL,
+	max_lat REAL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS data_event_idx ON data (org_id, source_event_timestamp, footprint_md5);
+DROP INDEX IF EXISTS data_timestamp_org_idx;
+CREATE INDEX IF NOT EXISTS data_page_idx ON data (source_event_timestamp, org_id, footprint_md5);
+CREATE TABLE IF NOT EXISTS load_checkpoints (
+	checksum TEXT PRIMARY KEY,
+	file_path TEXT NOT NULL,
+	line INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);`
+
+// sqliteVersion is the user_version of the current schema. Version 1 stores
+// timestamps in microseconds, version 0 stored nanoseconds.
+const sqliteVersion = 1
+
+// microsPerDay is the length of a UTC day in Unix microseconds
+const microsPerDay = int64(24 * time.Hour / time.Microsecond)
+
+// sqliteTime returns the stored value of a timestamp. Microseconds cover every
+// year the loader accepts, unlike nanoseconds which end in 2262.
+func sqliteTime(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// sqliteTimeOf returns the timestamp of a stored value
+func sqliteTimeOf(micros int64) time.Time {
+	return time.UnixMicro(micros).UTC()
+}
+
+// SqliteStorage keeps the usage events in a SQLite database. It needs no
+// server, so the loader and the API can run locally without Docker.
+type SqliteStorage struct {
+	db *sql.DB
+}
+
+// sqliteMaxConns is the number of connections to a database file. Readers
+// run next to each other, writers wait for the write lock.
+const sqliteMaxConns = 8
+
+// sqliteFileOptions enable write-ahead logging, so reads do not block on the
+// writer, and let writers wait for the lock instead of failing. Transactions
+// take the write lock when they begin.
+const sqliteFileOptions = "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_txlock=immediate"
+
+// OpenSqlite opens the SQLite database at path and creates its tables when
+// needed. The path ":memory:" opens a database that lives as long as the
+// storage.
+func OpenSqlite(path string) (*SqliteStorage, error) {
+	dsn := path
+	if path != ":memory:" {
+		dsn += sqliteFileOptions
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == ":memory:" {
+		// An in-memory database belongs to the connection that created it
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(sqliteMaxConns)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating sqlite schema: %w", err)
+	}
+	if err := upgradeSqlite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("upgrading sqlite schema: %w", err)
+	}
+	return &SqliteStorage{db: db}, nil
+}
+
+// upgradeSqlite converts a database written by an earlier schema version
+func upgradeSqlite(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version;").Scan(&version); err != nil {
+		return err
+	}
+	if version >= sqliteVersion {
+		return nil
+	}
+
+	// Events that only differ below a microsecond become duplicates, like
+	// they are in Postgres
+	if version < 1 {
+		if _, err := tx.Exec("UPDATE OR REPLACE data SET source_event_timestamp = source_event_timestamp / 1000;"); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", sqliteVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the database
+func (s *SqliteStorage) Close() error {
+	return s.db.Close()
+}
+
+// WriteEvents writes a batch of events in a transaction and skips duplicates
+func (s *SqliteStorage) WriteEvents(ctx context.Context, batch []UsageEvent) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO data (org_id, footprints_used, source_event_timestamp, footprint_md5, min_lon, min_lat, max_lon, max_lat)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING;`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var inserted int64
+	for _, event := range batch {
+		values, err := sqliteEventValues(event)
+		if err != nil {
+			return 0, err
+		}
+		result, err := stmt.ExecContext(ctx, values...)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		inserted += n
+	}
+
+	return inserted, tx.Commit()
+}
+
+// sqliteEventValues returns the values of the data columns for an event
+func sqliteEventValues(event UsageEvent) ([]interface{}, error) {
+	values, err := eventValues(event, false)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum([]byte(values[1].(string)))
+	values[2] = sqliteTime(event.Timestamp)
+	values = append(values, hex.EncodeToString(sum[:]))
+
+	if event.Footprint.Geometry == nil {
+		return append(values, nil, nil, nil, nil), nil
+	}
+	bound := event.Footprint.Geometry.Bound()
+	return append(values, bound.Min.Lon(), bound.Min.Lat(), bound.Max.Lon(), bound.Max.Lat()), nil
+}
+
+// sqliteConditions returns the SQL conditions of the filter and their
+// arguments. Placeholders are numbered starting at $1.
+func sqliteConditions(f CollectionFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.OrgID != nil {
+		args = append(args, *f.OrgID)
+		conditions = append(conditions, fmt.Sprintf("org_id = $%d", len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, sqliteTime(f.From))
+		conditions = append(conditions, fmt.Sprintf("source_event_timestamp >= $%d", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, sqliteTime(f.To))
+		conditions = append(conditions, fmt.Sprintf("source_event_timestamp < $%d", len(args)))
+	}
+	if f.BBox != nil {
+		args = append(args, f.BBox.Min.Lon(), f.BBox.Max.Lon(), f.BBox.Min.Lat(), f.BBox.Max.Lat())
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf("max_lon >= $%d AND min_lon <= $%d AND max_lat >= $%d AND min_lat <= $%d", n-3, n-2, n-1, n))
+	}
+
+	return conditions, args
+}
+
+// GetCollectionPage returns a page of the features matching the filter, ordered
+// by (source_event_timestamp, org_id, footprint_md5). The returned cursor points
+// at the last feature of the page and is nil when there are no more pages.
+func (s *SqliteStorage) GetCollectionPage(ctx context.Context, filter CollectionFilter, page PageRequest) (*geojson.FeatureCollection, *Cursor, error) {
+	conditions, args := sqliteConditions(filter)
+	if page.After != nil {
+		args = append(args, sqliteTime(page.After.Timestamp), page.After.OrgID, page.After.FootprintMD5)
+		conditions = append(conditions, fmt.Sprintf("(source_event_timestamp, org_id, footprint_md5) > ($%d, $%d, $%d)", len(args)-2, len(args)-1, len(args)))
+	}
+	// Fetch one extra row to find out whether a next page exists
+	args = append(args, page.Limit+1)
+	query := "SELECT org_id, footprints_used, source_event_timestamp, footprint_md5 FROM data" + joinConditions(conditions) +
+		fmt.Sprintf(" ORDER BY source_event_timestamp, org_id, footprint_md5 LIMIT $%d;", len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	fc := geojson.NewFeatureCollection()
+	var last, next *Cursor
+	var count int
+	for rows.Next() {
+		var cursor Cursor
+		var payload []byte
+		var timestamp int64
+
+		if err := rows.Scan(&cursor.OrgID, &payload, &timestamp, &cursor.FootprintMD5); err != nil {
+			return nil, nil, err
+		}
+		cursor.Timestamp = sqliteTimeOf(timestamp)
+		if count == page.Limit {
+			next = last
+			break
+		}
+		count++
+		last = &cursor
+
+		f, err := geojson.UnmarshalFeature(payload)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		fc.Append(f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return fc, next, nil
+}
+
+// StreamCollection reads the features matching the filter one row at a time and
+// passes each of them to fn. Iteration stops at the first error returned by fn.
+func (s *SqliteStorage) StreamCollection(ctx context.Context, filter CollectionFilter, fn func(*geojson.Feature) error) error {
+	conditions, args := sqliteConditions(filter)
+	rows, err := s.db.QueryContext(ctx, "SELECT footprints_used FROM data"+joinConditions(conditions)+";", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var payload []byte
+
+		if err := rows.Scan(&payload); err != nil {
+			log.Println(err)
+			continue
+		}
+		f, err := geojson.UnmarshalFeature(payload)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetOrgIDs returns the IDs of the organizations with events
+func (s *SqliteStorage) GetOrgIDs(ctx context.Context) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT DISTINCT org_id FROM data ORDER BY org_id;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgIDs []int
+	for rows.Next() {
+		var orgID int
+		if err := rows.Scan(&orgID); err != nil {
+			return nil, err
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+
+	return orgIDs, rows.Err()
+}
+
+// GetUsageSummary counts the events matching the filter and returns the
+// timestamps of the first and last of them
+func (s *SqliteStorage) GetUsageSummary(ctx context.Context, filter CollectionFilter) (UsageSummary, error) {
+	conditions, args := sqliteConditions(filter)
+	query := "SELECT COUNT(*), MIN(source_event_timestamp), MAX(source_event_timestamp) FROM data" + joinConditions(conditions) + ";"
+
+	var summary UsageSummary
+	var first, last sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&summary.Count, &first, &last); err != nil {
+		return UsageSummary{}, err
+	}
+	if first.Valid {
+		summary.First = sqliteTimeOf(first.Int64)
+		summary.Last = sqliteTimeOf(last.Int64)
+	}
+
+	return summary, nil
+}
+
+// GetDailyUsage counts the events matching the filter per UTC day
+func (s *SqliteStorage) GetDailyUsage(ctx context.Context, filter CollectionFilter) ([]DailyUsage, error) {
+	conditions, args := sqliteConditions(filter)
+	// Round down to the start of the day, also before 1970
+	day := fmt.Sprintf("source_event_timestamp - ((source_event_timestamp %% %[1]d) + %[1]d) %% %[1]d", microsPerDay)
+	rows, err := s.db.QueryContext(ctx, "SELECT "+day+" AS day, COUNT(*) FROM data"+joinConditions(conditions)+" GROUP BY day ORDER BY day;", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []DailyUsage
+	for rows.Next() {
+		var start int64
+		var usage DailyUsage
+		if err := rows.Scan(&start, &usage.Count); err != nil {
+			return nil, err
+		}
+		usage.Day = sqliteTimeOf(start)
+		days = append(days, usage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return days, nil
+}
+
+// GetCheckpoint returns the line up to which the file with the checksum was
+// loaded, or 0 when it has no checkpoint
+func (s *SqliteStorage) GetCheckpoint(ctx context.Context, checksum string) (int, error) {
+	var line int
+	err := s.db.QueryRowContext(ctx, "SELECT line FROM load_checkpoints WHERE checksum = $1;", checksum).Scan(&line)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return line, err
+}
+
+// SaveCheckpoint records that the file with the checksum was loaded up to line
+func (s *SqliteStorage) SaveCheckpoint(ctx context.Context, checksum, filePath string, line int) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO load_checkpoints (checksum, file_path, line, updated_at) VALUES ($1, $2, $3, $4)
+ON CONFLICT (checksum) DO UPDATE SET file_path = excluded.file_path, line = excluded.line, updated_at = excluded.updated_at;`,
+		checksum, filePath, line, time.Now().Unix())
+	return err
+}
+
+// DeleteCheckpoint removes the checkpoint of a file that was loaded completely
+func (s *SqliteStorage) DeleteCheckpoint(ctx context.Context, checksum string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM load_checkpoints WHERE checksum = $1;", checksum)
+	return err
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb/geojson"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The SQLite storage implements both sides and keeps checkpoints
+var (
+	_ backend         = (*SqliteStorage)(nil)
+	_ CheckpointStore = (*SqliteStorage)(nil)
+)
+
+// openTestSqlite opens an empty in-memory database
+func openTestSqlite(t *testing.T) *SqliteStorage {
+	s, err := OpenSqlite(":memory:")
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// errStopStream ends a stream in the tests
+var errStopStream = errors.New("stop")
+
+// Test the SQLite storage
+func TestSqliteStorage(t *testing.T) {
+	testBackend(t, func(t *testing.T) backend { return openTestSqlite(t) })
+}
+
+// Test the load checkpoints of the SQLite storage
+func TestSqliteStorage_Checkpoints(t *testing.T) {
+	s := openTestSqlite(t)
+
+	line, err := s.GetCheckpoint(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, line)
+
+	assert.NoError(t, s.SaveCheckpoint(context.Background(), "abc", "/app/data/sample.csv", 100))
+	assert.NoError(t, s.SaveCheckpoint(context.Background(), "abc", "/app/data/sample.csv", 200))
+	line, err = s.GetCheckpoint(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, line)
+
+	assert.NoError(t, s.DeleteCheckpoint(context.Background(), "abc"))
+	line, err = s.GetCheckpoint(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, line)
+}
+
+// Test a slow stream from a database file does not block other reads
+func TestSqliteStorage_ConcurrentReads(t *testing.T) {
+	s, err := OpenSqlite(filepath.Join(t.TempDir(), "planet.db"))
+	assert.NoError(t, err)
+	defer s.Close()
+	writeTestEvents(t, s)
+
+	var mode string
+	assert.NoError(t, s.db.QueryRow("PRAGMA journal_mode;").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+
+	streaming := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_ = s.StreamCollection(context.Background(), CollectionFilter{}, func(f *geojson.Feature) error {
+			close(streaming)
+			<-release
+			return errStopStream
+		})
+	}()
+	defer close(release)
+	<-streaming
+
+	done := make(chan error)
+	go func() {
+		_, err := s.GetOrgIDs(context.Background())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetOrgIDs blocked behind the stream")
+	}
+}
+
+// Test timestamps written in nanoseconds by schema version 0 are converted
+func TestSqliteStorage_UpgradeNanoseconds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "planet.db")
+	s, err := OpenSqlite(path)
+	assert.NoError(t, err)
+	writeTestEvents(t, s)
+
+	// Turn the database back into version 0
+	_, err = s.db.Exec("UPDATE data SET source_event_timestamp = source_event_timestamp * 1000; PRAGMA user_version = 0;")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	s, err = OpenSqlite(path)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	summary, err := s.GetUsageSummary(context.Background(), CollectionFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, UsageSummary{Count: 3, First: testTimestamp, Last: testTimestamp.Add(24 * time.Hour)}, summary)
+
+	var version int
+	assert.NoError(t, s.db.QueryRow("PRAGMA user_version;").Scan(&version))
+	assert.Equal(t, sqliteVersion, version)
+}
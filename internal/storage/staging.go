@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// StagedLoad loads records into a staging table inside a single transaction.
+// Nothing reaches the data table until Commit merges the staging table into
+// it, so a load that fails or is rolled back leaves the data table unchanged.
+type StagedLoad struct {
+	mu      sync.Mutex // the transaction runs on a single connection
+	tx      *sql.Tx
+	method  string
+	spatial bool
+}
+
+// BeginStagedLoad starts the transaction and creates the staging table. The
+// method selects how batches are written to it, see NewBatchInserter. The
+// transaction is rolled back when ctx is cancelled.
+func BeginStagedLoad(ctx context.Context, db *sql.DB, method string, spatial bool) (*StagedLoad, error) {
+	if method != LoadMethodInsert && method != LoadMethodCopy {
+		return nil, fmt.Errorf("unknown load method %q", method)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The staging table has no unique index, duplicates are skipped on merge
+	_, err = tx.ExecContext(ctx, "CREATE TEMP TABLE data_staging (LIKE data INCLUDING DEFAULTS) ON COMMIT DROP;")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return &StagedLoad{tx: tx, method: method, spatial: spatial}, nil
+}
+
+// WriteEvents writes a batch to the staging table and returns the number of
+// rows staged. Duplicates are only skipped on merge.
+func (s *StagedLoad) WriteEvents(ctx context.Context, batch []UsageEvent) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.method == LoadMethodCopy {
+		if err := copyRows(ctx, s.tx, "data_staging", batch, s.spatial); err != nil {
+			return 0, err
+		}
+		return int64(len(batch)), nil
+	}
+	return insertBatch(ctx, s.tx, "data_staging", "", batch, s.spatial)
+}
+
+// Commit merges the staging table into the data table, skipping duplicates,
+// and commits the transaction. It returns the number of rows merged.
+func (s *StagedLoad) Commit(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := columnList(s.spatial)
+	result, err := s.tx.ExecContext(ctx, "INSERT INTO data ("+list+") SELECT "+list+" FROM data_staging"+onConflict+";")
+	if err != nil {
+		s.tx.Rollback()
+		return 0, err
+	}
+	merged, err := result.RowsAffected()
+	if err != nil {
+		s.tx.Rollback()
+		return 0, err
+	}
+
+	return merged, s.tx.Commit()
+}
+
+// Rollback discards the staged rows
+func (s *StagedLoad) Rollback() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tx.Rollback()
+}
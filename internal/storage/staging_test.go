@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test a staged load inserts into the staging table and merges on commit
+func TestStagedLoad(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE data_staging").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO data_staging \(org_id, footprints_used, source_event_timestamp\) VALUES \(\$1, \$2, \$3\),\(\$4, \$5, \$6\)$`).
+		WithArgs(int64(1), emptyFeature, testTimestamp, int64(2), emptyFeature, testTimestamp).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO data \(org_id, footprints_used, source_event_timestamp\) SELECT .* FROM data_staging ON CONFLICT`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	staged, err := BeginStagedLoad(context.Background(), db, LoadMethodInsert, false)
+	assert.NoError(t, err)
+
+	inserted, err := staged.WriteEvents(context.Background(), []UsageEvent{testEvent(1, emptyFeature), testEvent(2, emptyFeature)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), inserted)
+
+	merged, err := staged.Commit(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), merged)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test a staged load copies batches into the staging table
+func TestStagedLoad_Copy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE data_staging").WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt := mock.ExpectPrepare(`COPY "data_staging" \("org_id", "footprints_used", "source_event_timestamp"\) FROM STDIN`)
+	copyStmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+	staged, err := BeginStagedLoad(context.Background(), db, LoadMethodCopy, false)
+	assert.NoError(t, err)
+
+	inserted, err := staged.WriteEvents(context.Background(), []UsageEvent{testEvent(1, emptyFeature)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), inserted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test a failed staged load is rolled back without touching the data table
+func TestStagedLoad_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE data_staging").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO data_staging").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	staged, err := BeginStagedLoad(context.Background(), db, LoadMethodInsert, false)
+	assert.NoError(t, err)
+
+	_, err = staged.WriteEvents(context.Background(), []UsageEvent{testEvent(1, emptyFeature)})
+	assert.Error(t, err)
+	assert.NoError(t, staged.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test BeginStagedLoad rejects unknown load methods
+func TestBeginStagedLoad_UnknownMethod(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = BeginStagedLoad(context.Background(), db, "bulk", false)
+	assert.Error(t, err)
+}
@@ -1,11 +1,66 @@
 package storage
 
 import (
+	"context"
+	"time"
+
 	_ "github.com/lib/pq"
 	"github.com/paulmach/orb/geojson"
 )
 
+// Storage backends
+const (
+	BackendPostgres = "postgres"
+	BackendSqlite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// Storage is the read side of a storage backend, the API depends on it. The
+// queries stop with the context's error when the context is done.
 type Storage interface {
-	GetCollection() (*geojson.FeatureCollection, error)
-	GetOrgIDs() ([]int, error)
+	GetCollectionPage(ctx context.Context, filter CollectionFilter, page PageRequest) (*geojson.FeatureCollection, *Cursor, error)
+	StreamCollection(ctx context.Context, filter CollectionFilter, fn func(*geojson.Feature) error) error
+	GetOrgIDs(ctx context.Context) ([]int, error)
+	GetUsageSummary(ctx context.Context, filter CollectionFilter) (UsageSummary, error)
+	GetDailyUsage(ctx context.Context, filter CollectionFilter) ([]DailyUsage, error)
+}
+
+// Writer is the write side of a storage backend. The loader depends on it
+// rather than on a database connection.
+type Writer interface {
+	// WriteEvents writes a batch of events and returns the number of events
+	// written. Events that were written before are skipped as duplicates.
+	WriteEvents(ctx context.Context, batch []UsageEvent) (int64, error)
+}
+
+// CheckpointStore keeps the line up to which a file was loaded, so that an
+// interrupted load can resume. Files are identified by their checksum.
+type CheckpointStore interface {
+	GetCheckpoint(ctx context.Context, checksum string) (int, error)
+	SaveCheckpoint(ctx context.Context, checksum, filePath string, line int) error
+	DeleteCheckpoint(ctx context.Context, checksum string) error
+}
+
+// UsageEvent is a parsed and validated usage event, ready to be written.
+// SourceFile and LineNo locate the event in its input file.
+type UsageEvent struct {
+	OrgID      int64
+	Footprint  *geojson.Feature
+	Timestamp  time.Time
+	SourceFile string
+	LineNo     int
+}
+
+// UsageSummary holds the number of events matching a filter and the time span
+// they cover. First and Last are zero when there are no events.
+type UsageSummary struct {
+	Count int
+	First time.Time
+	Last  time.Time
+}
+
+// DailyUsage holds the number of events of a UTC day
+type DailyUsage struct {
+	Day   time.Time
+	Count int
 }
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// PostgresWriter writes usage events to the data table of a Postgres database
+// and keeps the load checkpoints there
+type PostgresWriter struct {
+	db     *sql.DB
+	insert BatchInserter
+}
+
+// NewPostgresWriter returns a writer using the load method, see
+// NewBatchInserter
+func NewPostgresWriter(db *sql.DB, method string, spatial bool) (*PostgresWriter, error) {
+	insert, err := NewBatchInserter(method, spatial)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresWriter{db: db, insert: insert}, nil
+}
+
+// WriteEvents writes a batch of events and skips duplicates
+func (w *PostgresWriter) WriteEvents(ctx context.Context, batch []UsageEvent) (int64, error) {
+	return w.insert(ctx, w.db, batch)
+}
+
+// GetCheckpoint returns the line up to which the file with the checksum was
+// loaded, or 0 when it has no checkpoint
+func (w *PostgresWriter) GetCheckpoint(ctx context.Context, checksum string) (int, error) {
+	return GetCheckpoint(ctx, w.db, checksum)
+}
+
+// SaveCheckpoint records that the file with the checksum was loaded up to line
+func (w *PostgresWriter) SaveCheckpoint(ctx context.Context, checksum, filePath string, line int) error {
+	return SaveCheckpoint(ctx, w.db, checksum, filePath, line)
+}
+
+// DeleteCheckpoint removes the checkpoint of a file that was loaded completely
+func (w *PostgresWriter) DeleteCheckpoint(ctx context.Context, checksum string) error {
+	return DeleteCheckpoint(ctx, w.db, checksum)
+}